@@ -19,25 +19,43 @@ func main() {
 		"Assign : Token name, Expr value",
 		"Binary : Expr left, Token operator, Expr right",
 		"Call : Expr callee, Token paren, []ExprInterface arguments",
+		"Comptime : Token keyword, Expr expression, []StmtInterface body",
 		"Get : Expr object, Token name",
 		"Grouping : Expr expression",
+		"Index : Expr object, Token bracket, Expr index",
+		"Is : Expr object, Token operator, Expr target",
+		"List : Token bracket, []ExprInterface elements",
 		"Literal : Object value",
 		"Logical : Expr left, Token operator, Expr right",
+		"Map : Token brace, []ExprInterface keys, []ExprInterface values",
+		"Quote : Token keyword, []StmtInterface statements, Expr expression",
+		"Range : Expr start, Token operator, Expr end",
 		"Set : Expr object, Token name, Expr value",
+		"Spread : Token operator, Expr expression",
+		"This : Token keyword",
 		"Unary : Token operator, Expr right",
 		"Variable : Token name",
 	}, map[string]interface{}{})
 
 	defineAst(outputDir, "Stmt", []string{
 		"Block: []StmtInterface statements",
-		"Class: Token name, []StmtInterface methods",
+		"Class: Token name, []StmtInterface methods, []ExprInterface traits, []StmtInterface fields, bool sealed",
+		"Trait: Token name, []StmtInterface methods",
+		"Record: Token name, []Token fields, []StmtInterface methods",
+		"Enum: Token name, []Token members",
 		"Expression : Expr expression",
-		"Function: Token name, []Token params, []StmtInterface body",
+		"Function: Token name, []Token params, []StmtInterface body, bool variadic, bool generator, []Token paramTypes, Token returnType, []ExprInterface decorators, []*Assert requires, []*Assert ensures",
 		"If : Expr condition, Stmt thenBranch, Stmt elseBranch",
 		"Print : Expr expression",
-		"While: Expr condition, Stmt body",
-		"Var : Token name, Expr initializer",
+		"While: Expr condition, Stmt body, Expr increment",
+		"DoWhile: Stmt body, Expr condition",
+		"ForIn: Token name, Expr iterable, Stmt body",
+		"Var : Token name, Expr initializer, bool constant, Token type",
 		"Return: Token keyword, Expr value",
+		"Yield: Token keyword, Expr value",
+		"Defer: Token keyword, Expr call",
+		"Assert: Token keyword, Expr condition, Expr message, string source",
+		"Macro: Token keyword, Stmt function",
 	}, map[string]interface{}{"INTERFACE_CLASS": "Expr"})
 }
 
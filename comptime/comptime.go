@@ -0,0 +1,118 @@
+package comptime
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/resolver"
+	"github.com/weiser/lox/token"
+)
+
+// Evaluate runs every `comptime` expression in the program and replaces it with an expr.Literal
+// of its value, so it runs once per load however often the program reaches it. it runs after
+// parsing and before the resolver. each expression runs on its own in a restricted interpreter,
+// so it can only use what it declares itself and the natives that don't do I/O. the value is
+// shared by every evaluation of the literal, so it's frozen
+func Evaluate(stmts []expr.StmtInterface) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	replace(reflect.ValueOf(stmts))
+	return nil
+}
+
+var exprPackage = reflect.TypeOf(expr.Expr{}).PkgPath()
+
+// replace walks the AST with reflection rather than a visitor, so new node types are walked
+// without having to be listed here. nested comptime expressions are evaluated first
+func replace(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		replace(v.Elem())
+		if c, ok := v.Interface().(*expr.Comptime); ok {
+			v.Set(reflect.ValueOf(&expr.Literal{Value: evaluate(c)}))
+		}
+	case reflect.Ptr:
+		// the value of a literal isn't part of the AST
+		if _, ok := v.Interface().(*expr.Literal); ok {
+			return
+		}
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || v.Elem().Type().PkgPath() != exprPackage {
+			return
+		}
+		replace(v.Elem())
+	case reflect.Struct:
+		for f := 0; f < v.NumField(); f++ {
+			replace(v.Field(f))
+		}
+	case reflect.Slice:
+		for ind := 0; ind < v.Len(); ind++ {
+			replace(v.Index(ind))
+		}
+	}
+}
+
+func evaluate(c *expr.Comptime) interface{} {
+	i := interpreter.MakeRestrictedInterpreter()
+	stmts := make([]expr.StmtInterface, 0, 2)
+	result := c.Expression
+	if result == nil {
+		// the body runs as a function so it can `return` its value. `comptime` is a keyword, so
+		// the name can't collide with one the body declares
+		name := token.Token{TokenType: token.IDENTIFIER, Lexeme: "comptime", Line: c.Keyword.Line}
+		stmts = append(stmts, &expr.Function{Name: name, Body: c.Body})
+		result = &expr.Call{Callee: &expr.Variable{Name: name}, Paren: c.Keyword}
+	}
+	stmts = append(stmts, &expr.Expression{Expression: result})
+
+	r := resolver.Resolver{Interpreter: i, CurrentFunction: resolver.NONE}
+	if !r.ResolveStatements(stmts) {
+		panic(errors.New(fmt.Sprintf("%v: %v", c.Keyword, r.Errors[0])))
+	}
+	i.Interpret(stmts[:len(stmts)-1])
+	value := i.Evaluate(result)
+	if !isConstant(value) {
+		panic(errors.New(fmt.Sprintf("%v: comptime value must be a number, string, bool, nil, list, map or set, got %v", c.Keyword, i.Stringify(value))))
+	}
+	interpreter.Freeze(value)
+	return value
+}
+
+// isConstant reports whether a value is plain data, which can outlive the interpreter that made it
+func isConstant(value interface{}) bool {
+	switch v := value.(type) {
+	case nil, float64, string, bool:
+		return true
+	case *interpreter.LoxList:
+		for _, element := range v.Elements {
+			if !isConstant(element) {
+				return false
+			}
+		}
+		return true
+	case *interpreter.LoxMap:
+		for _, k := range v.Keys {
+			value, _ := v.Get(k)
+			if !isConstant(k) || !isConstant(value) {
+				return false
+			}
+		}
+		return true
+	case *interpreter.LoxSet:
+		for _, element := range v.Elements() {
+			if !isConstant(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
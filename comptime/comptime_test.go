@@ -0,0 +1,70 @@
+package comptime
+
+import (
+	"testing"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/parser"
+	"github.com/weiser/lox/scanner"
+)
+
+func parse(t *testing.T, src string) []expr.StmtInterface {
+	scanner := scanner.MakeScanner(src)
+	p := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, _ := p.Parse()
+	if p.ParsingErr != nil {
+		t.Fatalf("didn't parse, %v", p.ParsingErr)
+	}
+	return stmts
+}
+
+func TestEvaluate(t *testing.T) {
+	stmts := parse(t, `
+	var squares = comptime {
+		fun square(n) { return n * n; }
+		return [square(1), square(2), square(3)];
+	};
+	fun f() { return comptime (1 + comptime 2); }
+	`)
+	if err := Evaluate(stmts); err != nil {
+		t.Fatalf("didn't evaluate, %v", err)
+	}
+
+	squares, ok := stmts[0].(*expr.Var).Initializer.(*expr.Literal)
+	if !ok {
+		t.Fatalf("expected a Literal, got %v", stmts[0].(*expr.Var).Initializer)
+	}
+	elements := squares.Value.(*interpreter.LoxList).Elements
+	if len(elements) != 3 || elements[2] != 9.0 {
+		t.Errorf("expected [1, 4, 9], got %v", elements)
+	}
+	ret := stmts[1].(*expr.Function).Body[0].(*expr.Return)
+	if v, ok := ret.Value.(*expr.Literal); !ok || v.Value != 3.0 {
+		t.Errorf("expected a Literal of 3, got %v", ret.Value)
+	}
+}
+
+func TestEvaluateFreezes(t *testing.T) {
+	stmts := parse(t, `var s = comptime Set(1);`)
+	if err := Evaluate(stmts); err != nil {
+		t.Fatalf("didn't evaluate, %v", err)
+	}
+	if s := stmts[0].(*expr.Var).Initializer.(*expr.Literal).Value.(*interpreter.LoxSet); !s.Frozen {
+		t.Errorf("expected a comptime set to be frozen")
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []string{
+		`var a = comptime clock();`,
+		`var a = comptime { print 1; };`,
+		`var a = 1; var b = comptime a;`,
+		`var a = comptime { fun f() {} return f; };`,
+	}
+	for _, src := range tests {
+		if err := Evaluate(parse(t, src)); err == nil {
+			t.Errorf("expected `%v` to fail", src)
+		}
+	}
+}
@@ -7,16 +7,33 @@ import (
 )
 
 type Environment struct {
-	Values    map[string]interface{}
+	Values map[string]interface{}
+	// names declared with `const`. the resolver rejects assignments to local consts,
+	// globals are checked here at runtime
+	Constants map[string]bool
 	Enclosing *Environment
 }
 
 func MakeEnvironment(enclosing *Environment) Environment {
-	return Environment{Values: make(map[string]interface{}), Enclosing: enclosing}
+	return Environment{Values: make(map[string]interface{}), Constants: make(map[string]bool), Enclosing: enclosing}
 }
 
-func (e *Environment) Define(name string, value interface{}) {
+// Define fails if name is a constant, since redeclaring it would let it change. the resolver
+// rejects redeclaring local names, so this only happens with globals
+func (e *Environment) Define(name string, value interface{}) error {
+	if e.Constants[name] {
+		return fmt.Errorf("cannot redeclare constant %v", name)
+	}
 	e.Values[name] = value
+	return nil
+}
+
+func (e *Environment) DefineConst(name string, value interface{}) error {
+	if err := e.Define(name, value); err != nil {
+		return err
+	}
+	e.Constants[name] = true
+	return nil
 }
 
 func (e *Environment) Get(name string) (interface{}, error) {
@@ -46,13 +63,15 @@ func (e *Environment) Ancestor(distance int) *Environment {
 
 func (e *Environment) Assign(name string, value interface{}) (interface{}, error) {
 	if _, ok := e.Values[name]; ok {
+		if e.Constants[name] {
+			return nil, fmt.Errorf("cannot assign to constant %v", name)
+		}
 		e.Values[name] = value
 		return value, nil
 	}
 
 	if e.Enclosing != nil {
-		e.Enclosing.Assign(name, value)
-		return value, nil
+		return e.Enclosing.Assign(name, value)
 	}
 
 	return nil, fmt.Errorf("variable %v is not defined", name)
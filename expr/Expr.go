@@ -12,11 +12,20 @@ VisitExpr(e *Expr) interface{}
 VisitAssign(e *Assign) interface{}
 VisitBinary(e *Binary) interface{}
 VisitCall(e *Call) interface{}
+VisitComptime(e *Comptime) interface{}
 VisitGet(e *Get) interface{}
 VisitGrouping(e *Grouping) interface{}
+VisitIndex(e *Index) interface{}
+VisitIs(e *Is) interface{}
+VisitList(e *List) interface{}
 VisitLiteral(e *Literal) interface{}
 VisitLogical(e *Logical) interface{}
+VisitMap(e *Map) interface{}
+VisitQuote(e *Quote) interface{}
+VisitRange(e *Range) interface{}
 VisitSet(e *Set) interface{}
+VisitSpread(e *Spread) interface{}
+VisitThis(e *This) interface{}
 VisitUnary(e *Unary) interface{}
 VisitVariable(e *Variable) interface{}
 }
@@ -49,6 +58,15 @@ Arguments []ExprInterface
 func (o *Call) Accept(evi ExprVisitorInterface) interface{} {
 return evi.VisitCall(o)
 }
+type Comptime struct {
+*Expr
+Keyword Token
+Expression ExprInterface
+Body []StmtInterface
+}
+func (o *Comptime) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitComptime(o)
+}
 type Get struct {
 *Expr
 Object ExprInterface
@@ -64,6 +82,32 @@ Expression ExprInterface
 func (o *Grouping) Accept(evi ExprVisitorInterface) interface{} {
 return evi.VisitGrouping(o)
 }
+type Index struct {
+*Expr
+Object ExprInterface
+Bracket Token
+Index ExprInterface
+}
+func (o *Index) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitIndex(o)
+}
+type Is struct {
+*Expr
+Object ExprInterface
+Operator Token
+Target ExprInterface
+}
+func (o *Is) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitIs(o)
+}
+type List struct {
+*Expr
+Bracket Token
+Elements []ExprInterface
+}
+func (o *List) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitList(o)
+}
 type Literal struct {
 *Expr
 Value interface{}
@@ -80,6 +124,33 @@ Right ExprInterface
 func (o *Logical) Accept(evi ExprVisitorInterface) interface{} {
 return evi.VisitLogical(o)
 }
+type Map struct {
+*Expr
+Brace Token
+Keys []ExprInterface
+Values []ExprInterface
+}
+func (o *Map) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitMap(o)
+}
+type Quote struct {
+*Expr
+Keyword Token
+Statements []StmtInterface
+Expression ExprInterface
+}
+func (o *Quote) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitQuote(o)
+}
+type Range struct {
+*Expr
+Start ExprInterface
+Operator Token
+End ExprInterface
+}
+func (o *Range) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitRange(o)
+}
 type Set struct {
 *Expr
 Object ExprInterface
@@ -89,6 +160,21 @@ Value ExprInterface
 func (o *Set) Accept(evi ExprVisitorInterface) interface{} {
 return evi.VisitSet(o)
 }
+type Spread struct {
+*Expr
+Operator Token
+Expression ExprInterface
+}
+func (o *Spread) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitSpread(o)
+}
+type This struct {
+*Expr
+Keyword Token
+}
+func (o *This) Accept(evi ExprVisitorInterface) interface{} {
+return evi.VisitThis(o)
+}
 type Unary struct {
 *Expr
 Operator Token
@@ -13,13 +13,22 @@ type StmtVisitorInterface interface {
 	VisitStmt(e *Stmt) interface{}
 	VisitBlock(e *Block) interface{}
 	VisitClass(e *Class) interface{}
+	VisitTrait(e *Trait) interface{}
+	VisitRecord(e *Record) interface{}
+	VisitEnum(e *Enum) interface{}
 	VisitExpression(e *Expression) interface{}
 	VisitFunction(e *Function) interface{}
 	VisitIf(e *If) interface{}
 	VisitPrint(e *Print) interface{}
 	VisitWhile(e *While) interface{}
+	VisitDoWhile(e *DoWhile) interface{}
+	VisitForIn(e *ForIn) interface{}
 	VisitVar(e *Var) interface{}
 	VisitReturn(e *Return) interface{}
+	VisitYield(e *Yield) interface{}
+	VisitDefer(e *Defer) interface{}
+	VisitAssert(e *Assert) interface{}
+	VisitMacro(e *Macro) interface{}
 }
 
 func (o *Stmt) Accept(evi StmtVisitorInterface) interface{} {
@@ -39,12 +48,46 @@ type Class struct {
 	*Stmt
 	Name    Token
 	Methods []StmtInterface
+	Traits  []ExprInterface
+	Fields  []StmtInterface
+	Sealed  bool
 }
 
 func (o *Class) Accept(evi StmtVisitorInterface) interface{} {
 	return evi.VisitClass(o)
 }
 
+type Trait struct {
+	*Stmt
+	Name    Token
+	Methods []StmtInterface
+}
+
+func (o *Trait) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitTrait(o)
+}
+
+type Record struct {
+	*Stmt
+	Name    Token
+	Fields  []Token
+	Methods []StmtInterface
+}
+
+func (o *Record) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitRecord(o)
+}
+
+type Enum struct {
+	*Stmt
+	Name    Token
+	Members []Token
+}
+
+func (o *Enum) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitEnum(o)
+}
+
 type Expression struct {
 	*Stmt
 	Expression ExprInterface
@@ -56,9 +99,16 @@ func (o *Expression) Accept(evi StmtVisitorInterface) interface{} {
 
 type Function struct {
 	*Stmt
-	Name   Token
-	Params []Token
-	Body   []StmtInterface
+	Name       Token
+	Params     []Token
+	Body       []StmtInterface
+	Variadic   bool
+	Generator  bool
+	ParamTypes []Token
+	ReturnType Token
+	Decorators []ExprInterface
+	Requires   []*Assert
+	Ensures    []*Assert
 }
 
 func (o *Function) Accept(evi StmtVisitorInterface) interface{} {
@@ -89,16 +139,40 @@ type While struct {
 	*Stmt
 	Condition ExprInterface
 	Body      StmtInterface
+	Increment ExprInterface
 }
 
 func (o *While) Accept(evi StmtVisitorInterface) interface{} {
 	return evi.VisitWhile(o)
 }
 
+type DoWhile struct {
+	*Stmt
+	Body      StmtInterface
+	Condition ExprInterface
+}
+
+func (o *DoWhile) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitDoWhile(o)
+}
+
+type ForIn struct {
+	*Stmt
+	Name     Token
+	Iterable ExprInterface
+	Body     StmtInterface
+}
+
+func (o *ForIn) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitForIn(o)
+}
+
 type Var struct {
 	*Stmt
 	Name        Token
 	Initializer ExprInterface
+	Constant    bool
+	Type        Token
 }
 
 func (o *Var) Accept(evi StmtVisitorInterface) interface{} {
@@ -114,3 +188,45 @@ type Return struct {
 func (o *Return) Accept(evi StmtVisitorInterface) interface{} {
 	return evi.VisitReturn(o)
 }
+
+type Yield struct {
+	*Stmt
+	Keyword Token
+	Value   ExprInterface
+}
+
+func (o *Yield) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitYield(o)
+}
+
+type Defer struct {
+	*Stmt
+	Keyword Token
+	Call    ExprInterface
+}
+
+func (o *Defer) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitDefer(o)
+}
+
+type Assert struct {
+	*Stmt
+	Keyword   Token
+	Condition ExprInterface
+	Message   ExprInterface
+	Source    string
+}
+
+func (o *Assert) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitAssert(o)
+}
+
+type Macro struct {
+	*Stmt
+	Keyword  Token
+	Function StmtInterface
+}
+
+func (o *Macro) Accept(evi StmtVisitorInterface) interface{} {
+	return evi.VisitMacro(o)
+}
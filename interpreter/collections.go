@@ -0,0 +1,207 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LoxList is the runtime value of a list literal, e.g. `[1, 2, ...rest]`.
+// it is always passed around as a pointer so that every reference sees the same elements
+type LoxList struct {
+	Elements []interface{}
+}
+
+func (ll *LoxList) String() string {
+	elements := make([]string, 0, len(ll.Elements))
+	for _, e := range ll.Elements {
+		elements = append(elements, fmt.Sprintf("%v", e))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// LoxMap is the runtime value of a map literal, e.g. `{"a": 1, ...defaults}`.
+// Keys remembers insertion order so that printing and spreading are deterministic.
+// Entries is keyed by the hashKey of each key, so use Get and Set rather than indexing it
+type LoxMap struct {
+	Keys    []interface{}
+	Entries map[interface{}]interface{}
+}
+
+func MakeLoxMap() *LoxMap {
+	return &LoxMap{Keys: make([]interface{}, 0), Entries: make(map[interface{}]interface{})}
+}
+
+func (lm *LoxMap) Get(key interface{}) (interface{}, bool) {
+	v, ok := lm.Entries[hashKey(key)]
+	return v, ok
+}
+
+func (lm *LoxMap) Set(key interface{}, value interface{}) {
+	if _, ok := lm.Entries[hashKey(key)]; !ok {
+		if hasMutableSet(key) {
+			panic(errors.New("a Set must be frozen before it's used as a map key or set element"))
+		}
+		lm.Keys = append(lm.Keys, key)
+	}
+	lm.Entries[hashKey(key)] = value
+}
+
+func (lm *LoxMap) Delete(key interface{}) {
+	hk := hashKey(key)
+	if _, ok := lm.Entries[hk]; !ok {
+		return
+	}
+	delete(lm.Entries, hk)
+	for ind, k := range lm.Keys {
+		if hashKey(k) == hk {
+			lm.Keys = append(lm.Keys[:ind], lm.Keys[ind+1:]...)
+			break
+		}
+	}
+}
+
+func (lm *LoxMap) String() string {
+	entries := make([]string, 0, len(lm.Keys))
+	for _, k := range lm.Keys {
+		v, _ := lm.Get(k)
+		entries = append(entries, fmt.Sprintf("%v: %v", k, v))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// records are compared by value, so two records with equal fields must be the same map key.
+// recordKey stands in for a record in LoxMap.Entries
+type recordKey struct {
+	klass  *LoxClass
+	fields string
+}
+
+// setKey stands in for a set, which is equal to any set with the same elements
+type setKey struct {
+	elements string
+}
+
+// persistent collections can't change, so they're compared, and hashed, by their contents
+type persistentListKey struct {
+	elements string
+}
+
+type persistentMapKey struct {
+	entries string
+}
+
+func hashKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *LoxInstance:
+		if !k.Klass.isRecord() {
+			return key
+		}
+		fields := make([]interface{}, 0, len(k.Klass.RecordFields))
+		for _, field := range k.Klass.RecordFields {
+			fields = append(fields, k.Fields[field])
+		}
+		return recordKey{klass: k.Klass, fields: keyString(fields)}
+	case *LoxSet:
+		// sorted, so the order elements were added in doesn't matter
+		elements := keyStrings(k.Elements())
+		sort.Strings(elements)
+		return setKey{elements: strings.Join(elements, ", ")}
+	case *LoxPersistentList:
+		return persistentListKey{elements: keyString(k.Elements())}
+	case *LoxPersistentMap:
+		entries := make([]string, 0, k.entries.Len())
+		for _, key := range k.Keys() {
+			value, _ := k.lookup(key)
+			entries = append(entries, keyString([]interface{}{key, value}))
+		}
+		sort.Strings(entries)
+		return persistentMapKey{entries: strings.Join(entries, "; ")}
+	}
+	return key
+}
+
+// keyString combines values into a string that is the same for equal values
+func keyString(values []interface{}) string {
+	return strings.Join(keyStrings(values), ", ")
+}
+
+func keyStrings(values []interface{}) []string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		k := hashKey(v)
+		if reflect.ValueOf(k).Kind() == reflect.Ptr {
+			// objects other than records, sets and persistent collections are compared by identity
+			parts = append(parts, fmt.Sprintf("%T(%p)", k, k))
+		} else {
+			parts = append(parts, fmt.Sprintf("%#v", k))
+		}
+	}
+	return parts
+}
+
+// hasMutableSet reports whether a key holds a set that isn't frozen. changing it would change
+// the key's hashKey and lose its entry. like hashKey, it stops at values compared by identity
+func hasMutableSet(key interface{}) bool {
+	switch k := key.(type) {
+	case *LoxInstance:
+		if k.Klass.isRecord() {
+			for _, field := range k.Klass.RecordFields {
+				if hasMutableSet(k.Fields[field]) {
+					return true
+				}
+			}
+		}
+	case *LoxSet:
+		// a set's elements were checked when they were added
+		return !k.Frozen
+	case *LoxPersistentList:
+		for _, element := range k.Elements() {
+			if hasMutableSet(element) {
+				return true
+			}
+		}
+	case *LoxPersistentMap:
+		for _, key := range k.Keys() {
+			if value, _ := k.lookup(key); hasMutableSet(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// go maps panic when given a key that can't be hashed (e.g. a struct holding a map),
+// so we check before using a lox value as a map key. hashKey compares instances by identity,
+// or records by their fields, so an instance whose `__eq__` says otherwise can't be a key
+func isHashable(key interface{}) bool {
+	switch k := key.(type) {
+	case *LoxInstance:
+		if _, ok := k.Klass.FindMethod("__eq__"); ok {
+			return false
+		}
+		if k.Klass.isRecord() {
+			for _, field := range k.Klass.RecordFields {
+				if !isHashable(k.Fields[field]) {
+					return false
+				}
+			}
+		}
+	case *LoxPersistentList:
+		for _, element := range k.Elements() {
+			if !isHashable(element) {
+				return false
+			}
+		}
+	case *LoxPersistentMap:
+		// the keys were checked when they were set
+		for _, key := range k.Keys() {
+			if value, _ := k.lookup(key); !isHashable(value) {
+				return false
+			}
+		}
+	}
+	return key == nil || reflect.TypeOf(key).Comparable()
+}
@@ -0,0 +1,28 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/weiser/lox/expr"
+)
+
+// ioNatives are the natives a restricted interpreter leaves out, since their results or
+// effects depend on more than their arguments
+var ioNatives = []string{"clock", "deprecated"}
+
+// MakeRestrictedInterpreter makes an interpreter for code that runs before the program, e.g.
+// `comptime`. it can't print, and has no natives that do I/O
+func MakeRestrictedInterpreter() Interpreter {
+	i := MakeInterpreter()
+	i.restricted = true
+	for _, name := range ioNatives {
+		delete(i.env.Values, name)
+	}
+	return i
+}
+
+// comptime expressions are replaced with their values before the program runs, see comptime.Evaluate
+func (i *Interpreter) VisitComptime(exp *expr.Comptime) interface{} {
+	panic(errors.New(fmt.Sprintf("%v: comptime expression was not evaluated before running", exp.Keyword)))
+}
@@ -0,0 +1,41 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// ContractError is raised when a call breaks one of its function's `requires` or `ensures`
+// clauses. a broken `requires` is the caller's fault, a broken `ensures` is the function's
+type ContractError struct {
+	Function string
+	Clause   *expr.Assert
+}
+
+func (e ContractError) Error() string {
+	kind := "postcondition"
+	if e.Clause.Keyword.TokenType == token.REQUIRES {
+		kind = "precondition"
+	}
+	return fmt.Sprintf("line %v: %v of %v failed: %v %v", e.Clause.Keyword.Line, kind, e.Function, e.Clause.Keyword.Lexeme, e.Clause.Source)
+}
+
+func (i *Interpreter) checkContract(fxn *expr.Function, clauses []*expr.Assert, env environment.Environment) {
+	ci := *i
+	ci.env = env
+	for _, clause := range clauses {
+		if ok, _ := toTruthy(ci.Evaluate(clause.Condition)); !ok {
+			panic(ContractError{Function: fxn.Name.Lexeme, Clause: clause})
+		}
+	}
+}
+
+// checkEnsures checks the `ensures` clauses against the value a call returned, as `result`
+func (i *Interpreter) checkEnsures(fxn *expr.Function, env environment.Environment, result interface{}) {
+	resultEnv := environment.MakeEnvironment(&env)
+	resultEnv.Define("result", result)
+	i.checkContract(fxn, fxn.Ensures, resultEnv)
+}
@@ -0,0 +1,197 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// evaluateDecorators evaluates a function's decorators, in the order they are written
+func (i *Interpreter) evaluateDecorators(fxn *expr.Function) []interface{} {
+	decorators := make([]interface{}, 0, len(fxn.Decorators))
+	for _, d := range fxn.Decorators {
+		decorators = append(decorators, i.Evaluate(d))
+	}
+	return decorators
+}
+
+func (i *Interpreter) methodDecorators(methods []expr.StmtInterface) map[string][]interface{} {
+	decorators := make(map[string][]interface{})
+	for _, method := range methods {
+		if decl, ok := method.(*expr.Function); ok && len(decl.Decorators) > 0 {
+			decorators[decl.Name.Lexeme] = i.evaluateDecorators(decl)
+		}
+	}
+	return decorators
+}
+
+// decorate calls each decorator with fn, starting with the one written nearest the function,
+// and returns what the last one returned
+func (i *Interpreter) decorate(fn interface{}, decorators []interface{}, name token.Token) interface{} {
+	for ind := len(decorators) - 1; ind >= 0; ind-- {
+		decorator, ok := decorators[ind].(LoxCallable)
+		if !ok || !arityMatches(decorator, 1) {
+			panic(errors.New(fmt.Sprintf("%v: a decorator must be a function taking 1 argument, got %v", name, i.Stringify(decorators[ind]))))
+		}
+		fn = decorator.Call(i, []interface{}{fn})
+	}
+	return fn
+}
+
+// decorateMethods applies each method's decorators once, when its class is declared. they're
+// called with an unboundMethod, and what they return is bound to an instance by boundMethod
+func (i *Interpreter) decorateMethods(methods map[string]LoxFunction, decorators map[string][]interface{}) map[string]LoxCallable {
+	decorated := make(map[string]LoxCallable)
+	for name, d := range decorators {
+		method := methods[name]
+		fn := i.decorate(unboundMethod{method}, d, method.Declaration.Name)
+		callable, ok := fn.(LoxCallable)
+		if !ok {
+			panic(errors.New(fmt.Sprintf("%v: a method decorator must return a function, got %v", method.Declaration.Name, typeName(fn))))
+		}
+		decorated[name] = callable
+	}
+	return decorated
+}
+
+// unboundMethod is what a method's decorators wrap. calling it calls the method bound to the
+// instance the decorated method was read from
+type unboundMethod struct {
+	method LoxFunction
+}
+
+func (um unboundMethod) Arity() int {
+	return um.method.Arity()
+}
+
+func (um unboundMethod) Variadic() bool {
+	return um.method.Variadic()
+}
+
+func (um unboundMethod) Call(i *Interpreter, arguments []interface{}) interface{} {
+	if i.receiver == nil {
+		panic(errors.New(fmt.Sprintf("%v: method called without an instance", um.method.Declaration.Name)))
+	}
+	return um.method.Bind(i.receiver).Call(i, arguments)
+}
+
+func (um unboundMethod) String() string {
+	return um.method.String()
+}
+
+// boundMethod is a decorated method read from an instance. it's a pointer so that comparing
+// two of them never compares the functions they wrap
+type boundMethod struct {
+	fn   LoxCallable
+	this *LoxInstance
+}
+
+func (bm *boundMethod) Arity() int {
+	return bm.fn.Arity()
+}
+
+func (bm *boundMethod) Variadic() bool {
+	v, ok := bm.fn.(VariadicCallable)
+	return ok && v.Variadic()
+}
+
+func (bm *boundMethod) Call(i *Interpreter, arguments []interface{}) interface{} {
+	receiver := i.receiver
+	i.receiver = bm.this
+	defer func() { i.receiver = receiver }()
+	return bm.fn.Call(i, arguments)
+}
+
+func (bm *boundMethod) String() string {
+	return fmt.Sprint(bm.fn)
+}
+
+// method finds li's method called name and binds it to li. every call the interpreter makes
+// on an instance goes through here, so decorated methods are used for `__add__`, `toString`, etc.
+func (li *LoxInstance) method(name string) (LoxCallable, bool) {
+	if fn, ok := li.Klass.Decorated[name]; ok {
+		return &boundMethod{fn: fn, this: li}, true
+	}
+	if method, ok := li.Klass.FindMethod(name); ok {
+		return method.Bind(li), true
+	}
+	return nil, false
+}
+
+func toCallable(fxn string, value interface{}) LoxCallable {
+	callable, ok := value.(LoxCallable)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: expected a function, got %v", fxn, typeName(value))))
+	}
+	return callable
+}
+
+func callableName(callable LoxCallable) string {
+	switch c := callable.(type) {
+	case LoxFunction:
+		return c.Declaration.Name.Lexeme
+	case NativeFunction:
+		return c.Name
+	case unboundMethod:
+		return c.method.Declaration.Name.Lexeme
+	}
+	return fmt.Sprint(callable)
+}
+
+// wrap makes a native function that takes the same arguments as callable
+func wrap(callable LoxCallable, fn func(i *Interpreter, arguments []interface{}) interface{}) NativeFunction {
+	variadic := false
+	if v, ok := callable.(VariadicCallable); ok {
+		variadic = v.Variadic()
+	}
+	return NativeFunction{Name: callableName(callable), NumArgs: callable.Arity(), Varargs: variadic, Fn: fn}
+}
+
+// defineDecoratorNatives adds the builtin decorators, e.g. `@memoize fun fib(n) { ... }`
+func defineDecoratorNatives(env environment.Environment) {
+	natives := []NativeFunction{
+		{Name: "memoize", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			fn := toCallable("memoize", arguments[0])
+			cache := make(map[string]interface{})
+			return wrap(fn, func(i *Interpreter, arguments []interface{}) interface{} {
+				for _, arg := range arguments {
+					if !isHashable(arg) {
+						panic(errors.New(fmt.Sprintf("memoize: %v can't be used as a cache key", i.Stringify(arg))))
+					}
+				}
+				key := keyString(arguments)
+				// a method's cache is shared by the class, so it's also keyed by the instance
+				if _, ok := fn.(unboundMethod); ok {
+					key = fmt.Sprintf("%p %v", i.receiver, key)
+				}
+				if v, ok := cache[key]; ok {
+					return v
+				}
+				v := fn.Call(i, arguments)
+				cache[key] = v
+				return v
+			})
+		}},
+		{Name: "deprecated", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			message := i.Stringify(arguments[0])
+			return NativeFunction{Name: "deprecated", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+				fn := toCallable("deprecated", arguments[0])
+				warned := false
+				return wrap(fn, func(i *Interpreter, arguments []interface{}) interface{} {
+					if !warned {
+						fmt.Fprintf(os.Stderr, "warning: %v is deprecated: %v\n", callableName(fn), message)
+						warned = true
+					}
+					return fn.Call(i, arguments)
+				})
+			}}
+		}},
+	}
+	for _, native := range natives {
+		env.Define(native.Name, native)
+	}
+}
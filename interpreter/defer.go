@@ -0,0 +1,28 @@
+package interpreter
+
+import (
+	"github.com/weiser/lox/expr"
+)
+
+// VisitDefer evaluates the callee and arguments now; the call itself waits until the function returns
+func (i *Interpreter) VisitDefer(stmt *expr.Defer) interface{} {
+	call := stmt.Call.(*expr.Call)
+	callee := i.Evaluate(call.Callee)
+	arguments := i.evaluateArguments(call.Arguments)
+	fxn := i.checkCallable(callee, arguments, call)
+
+	*i.deferred = append(*i.deferred, func() { fxn.Call(i, arguments) })
+	return nil
+}
+
+// runDeferred runs the deferred calls last in, first out. like go's defer, the rest still run
+// when one of them raises an error
+func runDeferred(calls *[]func()) {
+	if len(*calls) == 0 {
+		return
+	}
+	call := (*calls)[len(*calls)-1]
+	*calls = (*calls)[:len(*calls)-1]
+	defer runDeferred(calls)
+	call()
+}
@@ -0,0 +1,68 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// LoxEnum is the namespace created by `enum Color { Red, Green, Blue }`
+type LoxEnum struct {
+	Name   string
+	Values []*LoxEnumValue
+}
+
+// LoxEnumValue is a single member, e.g. `Color.Red`. members are only ever created by
+// VisitEnum and are compared by identity, so `Color.Red == Color.Red` and two enums with
+// a member of the same name are still different
+type LoxEnumValue struct {
+	Enum    *LoxEnum
+	Name    string
+	Ordinal int
+}
+
+func (le *LoxEnum) Get(name token.Token) interface{} {
+	for _, v := range le.Values {
+		if v.Name == name.Lexeme {
+			return v
+		}
+	}
+	if name.Lexeme == "values" {
+		return NativeFunction{Name: "values", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			values := make([]interface{}, 0, len(le.Values))
+			for _, v := range le.Values {
+				values = append(values, v)
+			}
+			return &LoxList{Elements: values}
+		}}
+	}
+	panic(fmt.Sprintf("%v: enum %v has no member '%v'", name, le.Name, name.Lexeme))
+}
+
+func (le *LoxEnum) String() string {
+	return fmt.Sprintf("<enum %v>", le.Name)
+}
+
+func (lev *LoxEnumValue) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "name":
+		return lev.Name
+	case "ordinal":
+		return float64(lev.Ordinal)
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+func (lev *LoxEnumValue) String() string {
+	return lev.Enum.Name + "." + lev.Name
+}
+
+func (i *Interpreter) VisitEnum(stmt *expr.Enum) interface{} {
+	enum := &LoxEnum{Name: stmt.Name.Lexeme, Values: make([]*LoxEnumValue, 0, len(stmt.Members))}
+	for ordinal, member := range stmt.Members {
+		enum.Values = append(enum.Values, &LoxEnumValue{Enum: enum, Name: member.Lexeme, Ordinal: ordinal})
+	}
+	i.define(enum.Name, enum)
+	return nil
+}
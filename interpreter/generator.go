@@ -0,0 +1,232 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+/*
+LoxGenerator is returned by calling a generator function, e.g.
+
+```
+fun* range(n) { var i = 0; while (i < n) { yield i; i = i + 1; } }
+var g = range(3);
+g.next(); // 0
+```
+
+the tree-walk interpreter keeps its state on the go stack, so the generator's body runs
+on its own goroutine. the goroutine and the caller hand control back and forth over
+unbuffered channels, so they never run at the same time.
+
+a goroutine paused at a yield only exits when its generator is closed. `for` closes the
+generators it stops early, and a generator that's garbage collected while paused is closed
+the next time a generator is made, see closeAbandoned. when that happens depends on the
+garbage collector, so an abandoned generator's deferred calls don't run at all.
+*/
+type LoxGenerator struct {
+	// the goroutine only refers to the generator, not the LoxGenerator, so the LoxGenerator
+	// can be garbage collected while the goroutine is paused
+	*generator
+}
+
+type generator struct {
+	Name string
+	// resume tells a paused generator to keep going (true) or to unwind because it was closed (false)
+	resume chan bool
+	yields chan generatorResult
+	start  func()
+
+	started bool
+	done    bool
+	// set while the body runs, so that calling next() from inside it fails instead of deadlocking
+	running bool
+	// closeAbandoned sets this so that closing the generator doesn't run its deferred calls
+	skipDeferred bool
+	// hasNext() runs the generator to its next yield; the value waits here for next()
+	pending *generatorResult
+}
+
+type generatorResult struct {
+	value interface{}
+	done  bool
+	err   interface{}
+}
+
+// errGeneratorClosed unwinds a paused generator's goroutine after Close
+type errGeneratorClosed struct{}
+
+// abandoned holds the generators whose LoxGenerator was garbage collected. finalizers run on
+// their own goroutine, so rather than closing them there they're closed by closeAbandoned,
+// on the interpreter's goroutine
+var abandoned struct {
+	sync.Mutex
+	generators []*generator
+}
+
+func abandon(g *LoxGenerator) {
+	abandoned.Lock()
+	defer abandoned.Unlock()
+	abandoned.generators = append(abandoned.generators, g.generator)
+}
+
+func closeAbandoned() {
+	abandoned.Lock()
+	generators := abandoned.generators
+	abandoned.generators = nil
+	abandoned.Unlock()
+	for _, g := range generators {
+		g.skipDeferred = true
+		g.Close()
+	}
+}
+
+func MakeGenerator(i *Interpreter, fxn LoxFunction, env environment.Environment) *LoxGenerator {
+	closeAbandoned()
+	g := &generator{Name: fxn.Declaration.Name.Lexeme, resume: make(chan bool), yields: make(chan generatorResult)}
+	interp := *i
+	interp.generator = g
+	interp.deferred = &[]func(){}
+	g.start = func() {
+		go func() {
+			result := generatorResult{done: true}
+			defer func() {
+				if err := recover(); err != nil {
+					switch err.(type) {
+					case ErrReturn, errGeneratorClosed:
+					default:
+						result = generatorResult{err: err}
+					}
+				}
+				g.yields <- result
+			}()
+			// deferred calls also run when a paused generator is closed, unless it was abandoned
+			defer func() {
+				if !g.skipDeferred {
+					runDeferred(interp.deferred)
+				}
+			}()
+			interp.ExecuteBlock(fxn.Declaration.Body, env)
+		}()
+	}
+	lg := &LoxGenerator{generator: g}
+	runtime.SetFinalizer(lg, abandon)
+	return lg
+}
+
+// advance runs the generator until it yields or finishes. runtime errors raised by the
+// generator's body are re-raised on the caller's goroutine
+func (g *generator) advance() generatorResult {
+	if g.pending != nil {
+		r := *g.pending
+		g.pending = nil
+		return r
+	}
+	if g.done {
+		return generatorResult{done: true}
+	}
+	g.checkNotRunning()
+	g.running = true
+	if !g.started {
+		g.started = true
+		g.start()
+	} else {
+		g.resume <- true
+	}
+	r := <-g.yields
+	g.running = false
+	if r.done || r.err != nil {
+		g.done = true
+	}
+	if r.err != nil {
+		panic(r.err)
+	}
+	return r
+}
+
+// Next returns the next yielded value. once the generator is exhausted it returns nil, false
+func (g *generator) Next() (interface{}, bool) {
+	r := g.advance()
+	return r.value, !r.done
+}
+
+func (g *generator) HasNext() bool {
+	if g.pending == nil {
+		r := g.advance()
+		g.pending = &r
+	}
+	return !g.pending.done
+}
+
+// Close stops a generator that is paused at a yield so its goroutine can exit
+func (g *generator) Close() {
+	if g.done {
+		return
+	}
+	g.checkNotRunning()
+	g.done = true
+	g.pending = nil
+	if g.started {
+		g.resume <- false
+		<-g.yields
+	}
+}
+
+func (g *generator) checkNotRunning() {
+	if g.running {
+		panic(errors.New(fmt.Sprintf("generator %v is already running", g.Name)))
+	}
+}
+
+// yield is called from the generator's goroutine by VisitYield
+func (g *generator) yield(value interface{}) {
+	g.yields <- generatorResult{value: value}
+	if !<-g.resume {
+		panic(errGeneratorClosed{})
+	}
+}
+
+func (g *LoxGenerator) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "next":
+		return NativeFunction{Name: "next", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			v, _ := g.Next()
+			// in `gen().next()` nothing else refers to g, and it mustn't be closed while it runs
+			runtime.KeepAlive(g)
+			return v
+		}}
+	case "hasNext":
+		return NativeFunction{Name: "hasNext", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			hasNext := g.HasNext()
+			runtime.KeepAlive(g)
+			return hasNext
+		}}
+	case "close":
+		return NativeFunction{Name: "close", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			g.Close()
+			return nil
+		}}
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+func (g *LoxGenerator) String() string {
+	return fmt.Sprintf("<generator %v>", g.Name)
+}
+
+func (i *Interpreter) VisitYield(stmt *expr.Yield) interface{} {
+	if i.generator == nil {
+		panic(fmt.Sprintf("%v: can only yield inside a generator", stmt.Keyword))
+	}
+	var value interface{}
+	if stmt.Value != nil {
+		value = i.Evaluate(stmt.Value)
+	}
+	i.generator.yield(value)
+	return nil
+}
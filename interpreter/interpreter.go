@@ -3,6 +3,7 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/weiser/lox/environment"
@@ -10,9 +11,25 @@ import (
 	"github.com/weiser/lox/token"
 )
 
+// classes are always passed around as pointers, so isInstance can compare them by identity
 type LoxClass struct {
 	Name    string
 	Methods map[string]LoxFunction
+	// the traits named in the class's `with` clause
+	Traits []*LoxTrait
+	// fields declared with `var` in the class body, initialized for each instance before `init` runs
+	Fields  []*expr.Var
+	Closure environment.Environment
+	// instances of a sealed class can't create fields other than the declared ones
+	Sealed bool
+	// for records, the fields in the order the constructor takes them
+	RecordFields []string
+	// decorated methods, decorated once when the class is declared, see decorateMethods
+	Decorated map[string]LoxCallable
+}
+
+func (lc *LoxClass) isRecord() bool {
+	return lc.RecordFields != nil
 }
 
 /* loxclass needs to implement loxcallable so that we can do stuff like:
@@ -23,46 +40,118 @@ A();
 to instantiate an instance of A
 
 */
-func (lc LoxClass) Arity() int {
+func (lc *LoxClass) Arity() int {
+	if lc.isRecord() {
+		return len(lc.RecordFields)
+	}
+	if initializer, ok := lc.FindMethod("init"); ok {
+		return initializer.Arity()
+	}
 	return 0
 }
 
-func (lc LoxClass) Call(i *Interpreter, arguments []interface{}) (retVal interface{}) {
-	instance := LoxInstance{Klass: lc, Fields: make(map[string]interface{})}
+func (lc *LoxClass) Variadic() bool {
+	initializer, ok := lc.FindMethod("init")
+	return ok && initializer.Variadic()
+}
+
+func (lc *LoxClass) Call(i *Interpreter, arguments []interface{}) (retVal interface{}) {
+	instance := &LoxInstance{Klass: lc, Fields: make(map[string]interface{})}
+	if lc.isRecord() {
+		for ind, field := range lc.RecordFields {
+			instance.Fields[field] = arguments[ind]
+		}
+		instance.Frozen = true
+		return instance
+	}
+	lc.initializeFields(i, instance)
+	if initializer, ok := lc.FindMethod("init"); ok {
+		initializer.Bind(instance).Call(i, arguments)
+	}
 	return instance
 }
 
+// LoxTrait holds methods that classes declared `with` the trait copy into their own Methods
+type LoxTrait struct {
+	Name       string
+	Methods    map[string]LoxFunction
+	Decorators map[string][]interface{}
+}
+
+func (lt *LoxTrait) String() string {
+	return fmt.Sprintf("<trait %v>", lt.Name)
+}
+
+// instances are always passed around as pointers, so `==` compares identity
 type LoxInstance struct {
-	Klass  LoxClass
+	Klass  *LoxClass
 	Fields map[string]interface{}
+	// frozen instances (records, or anything passed to `freeze`) can't have their fields set
+	Frozen bool
 }
 
-func (li LoxInstance) String() string {
+func (li *LoxInstance) String() string {
 	return li.Klass.Name + " instance"
 }
 
-func (li LoxInstance) Get(name token.Token) interface{} {
+func (li *LoxInstance) Get(name token.Token) interface{} {
 	if v, ok := li.Fields[name.Lexeme]; ok {
 		return v
 	}
 
-	method, ok := li.Klass.FindMethod(name.Lexeme)
+	method, ok := li.method(name.Lexeme)
 	if ok {
 		return method
 	}
+	if name.Lexeme == "toString" && li.Klass.isRecord() {
+		return NativeFunction{Name: "toString", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return i.recordString(li)
+		}}
+	}
 
 	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
 }
 
-func (li LoxInstance) Set(name token.Token, value interface{}) {
-	li.Fields[name.Lexeme] = value
+func (li *LoxInstance) Set(name token.Token, value interface{}) {
+	if err := li.setField(name.Lexeme, value); err != nil {
+		panic(errors.New(fmt.Sprintf("%v: %v", name, err)))
+	}
+}
+
+func (li *LoxInstance) setField(name string, value interface{}) error {
+	if li.Frozen {
+		return fmt.Errorf("cannot modify frozen %v", li)
+	}
+	if _, ok := li.Fields[name]; !ok && li.Klass.Sealed {
+		return fmt.Errorf("%v is sealed and has no field '%v'", li.Klass.Name, name)
+	}
+	li.Fields[name] = value
+	return nil
 }
 
-func (lc LoxClass) String() string {
+// initializeFields evaluates each field declaration's initializer with `this` bound to instance
+func (lc *LoxClass) initializeFields(i *Interpreter, instance *LoxInstance) {
+	if len(lc.Fields) == 0 {
+		return
+	}
+	env := environment.MakeEnvironment(&lc.Closure)
+	env.Define("this", instance)
+	i2 := *i
+	i2.env = env
+	for _, field := range lc.Fields {
+		var value interface{}
+		if field.Initializer != nil {
+			value = (&i2).Evaluate(field.Initializer)
+		}
+		instance.Fields[field.Name.Lexeme] = value
+	}
+}
+
+func (lc *LoxClass) String() string {
 	return lc.Name
 }
 
-func (lc LoxClass) FindMethod(name string) (LoxFunction, bool) {
+func (lc *LoxClass) FindMethod(name string) (LoxFunction, bool) {
 	v, ok := lc.Methods[name]
 	return v, ok
 }
@@ -72,28 +161,92 @@ type LoxFunction struct {
 	Closure     environment.Environment
 }
 
+// for variadic functions, Arity is the number of parameters before the rest parameter
 func (lf LoxFunction) Arity() int {
+	if lf.Declaration.Variadic {
+		return len(lf.Declaration.Params) - 1
+	}
 	return len(lf.Declaration.Params)
 }
 
-func (lf LoxFunction) Call(i *Interpreter, arguments []interface{}) (retVal interface{}) {
+func (lf LoxFunction) Variadic() bool {
+	return lf.Declaration.Variadic
+}
+
+// a function's closure can hold the function itself, so it must never be formatted field by field
+func (lf LoxFunction) String() string {
+	return fmt.Sprintf("<fn %v>", lf.Declaration.Name.Lexeme)
+}
+
+// Bind makes a method whose closure defines `this` as the given instance
+func (lf LoxFunction) Bind(instance *LoxInstance) LoxFunction {
+	env := environment.MakeEnvironment(&lf.Closure)
+	env.Define("this", instance)
+	return LoxFunction{Declaration: lf.Declaration, Closure: env}
+}
+
+// Call runs the function's body. a `return` of a call to another lox function hands that call
+// back here instead of making it, so tail recursive functions run in constant stack space
+func (lf LoxFunction) Call(i *Interpreter, arguments []interface{}) interface{} {
+	for {
+		retVal, tail := lf.call(i, arguments)
+		if tail == nil {
+			return retVal
+		}
+		lf, arguments = tail.fxn, tail.arguments
+	}
+}
+
+func (lf LoxFunction) call(i *Interpreter, arguments []interface{}) (interface{}, *tailCall) {
+	environment := environment.MakeEnvironment(&lf.Closure)
+	params := lf.Declaration.Params
+	if lf.Declaration.Variadic {
+		rest := params[len(params)-1]
+		params = params[:len(params)-1]
+		environment.Define(rest.Lexeme, &LoxList{Elements: append([]interface{}{}, arguments[len(params):]...)})
+	}
+	for i, p := range params {
+		environment.Define(p.Lexeme, arguments[i])
+	}
+	if !i.DisableContracts {
+		i.checkContract(&lf.Declaration, lf.Declaration.Requires, environment)
+	}
+	if lf.Declaration.Generator {
+		// the body doesn't run until the generator is asked for its first value
+		return MakeGenerator(i, lf, environment), nil
+	}
+	retVal, tail := lf.execute(i, environment)
+	if len(lf.Declaration.Ensures) > 0 && !i.DisableContracts {
+		// the returned call has to finish before its result can be checked, so it can't be a tail call
+		if tail != nil {
+			retVal, tail = tail.fxn.Call(i, tail.arguments), nil
+		}
+		i.checkEnsures(&lf.Declaration, environment, retVal)
+	}
+	return retVal, tail
+}
+
+// execute runs the function's body, catching the value of its `return`
+func (lf LoxFunction) execute(i *Interpreter, env environment.Environment) (retVal interface{}, tail *tailCall) {
 	defer func() {
 		if err := recover(); err != nil {
 			if v, ok := err.(ErrReturn); !ok {
 				panic(err)
 			} else {
 				// here is where we catch any return values from a return statement
-				retVal = v.Value
+				retVal, tail = v.Value, v.tailCall
 			}
 		}
 
 	}()
-	environment := environment.MakeEnvironment(&lf.Closure)
-	for i, p := range lf.Declaration.Params {
-		environment.Define(p.Lexeme, arguments[i])
-	}
-	i.ExecuteBlock(lf.Declaration.Body, environment)
-	return retVal
+	// deferred calls run before the return value is caught above, even if the body panics
+	fi := *i
+	fi.deferred = &[]func(){}
+	// a function called by a generator's body isn't part of the generator
+	fi.generator = nil
+	defer runDeferred(fi.deferred)
+	fi.ExecuteBlock(lf.Declaration.Body, env)
+	return retVal, tail
 }
 
 type LoxCallable interface {
@@ -101,20 +254,62 @@ type LoxCallable interface {
 	Call(i *Interpreter, arguments []interface{}) interface{}
 }
 
+// VariadicCallable is implemented by callables that accept more than Arity() arguments
+type VariadicCallable interface {
+	LoxCallable
+	Variadic() bool
+}
+
+func arityMatches(fxn LoxCallable, argc int) bool {
+	if v, ok := fxn.(VariadicCallable); ok && v.Variadic() {
+		return argc >= fxn.Arity()
+	}
+	return argc == fxn.Arity()
+}
+
 type ErrBreak struct {
 }
 
+// ErrContinue ends the current iteration of the innermost loop
+type ErrContinue struct {
+}
+
 type ErrReturn struct {
 	Value interface{}
+	// set instead of Value when the function returns the result of calling another lox function
+	tailCall *tailCall
+}
+
+// tailCall is a call in tail position, e.g. `return f(x);`, that the caller's LoxFunction.Call makes for it
+type tailCall struct {
+	fxn       LoxFunction
+	arguments []interface{}
 }
 
 func (e *ErrBreak) Error() string {
 	return fmt.Sprintf("Break encountered")
 }
 
+// LoxObject is implemented by values that have properties, e.g. `instance.field` or `generator.next`
+type LoxObject interface {
+	Get(name token.Token) interface{}
+}
+
 type Interpreter struct {
 	env    environment.Environment
 	Locals map[interface{}]int
+	// set while running the body of a generator, so `yield` knows where to send values
+	generator *generator
+	// calls scheduled with `defer` by the function that is running
+	deferred *[]func()
+	// when set, `assert` statements are skipped without evaluating their condition
+	DisableAssertions bool
+	// when set, functions' `requires` and `ensures` clauses aren't checked
+	DisableContracts bool
+	// set for code that runs before the program, which can't `print`. see MakeRestrictedInterpreter
+	restricted bool
+	// the instance a decorated method was called on, see boundMethod
+	receiver *LoxInstance
 }
 
 var Globals environment.Environment
@@ -129,9 +324,32 @@ func (gclock *GlobalClock) String() string {
 	return "<native fxn: global clock>"
 }
 
+// NativeFunction is a lox callable implemented in go, e.g. the methods of built in types
+type NativeFunction struct {
+	Name    string
+	NumArgs int
+	// when set, the function also accepts any number of arguments after the first NumArgs
+	Varargs bool
+	Fn      func(i *Interpreter, arguments []interface{}) interface{}
+}
+
+func (nf NativeFunction) Arity() int     { return nf.NumArgs }
+func (nf NativeFunction) Variadic() bool { return nf.Varargs }
+func (nf NativeFunction) Call(i *Interpreter, arguments []interface{}) interface{} {
+	return nf.Fn(i, arguments)
+}
+func (nf NativeFunction) String() string {
+	return fmt.Sprintf("<native fxn: %v>", nf.Name)
+}
+
 func InitGlobals() environment.Environment {
 	Globals = environment.MakeEnvironment(nil)
-	Globals.Define("clock", GlobalClock{})
+	Globals.Define("clock", &GlobalClock{})
+	defineReflectionNatives(Globals)
+	defineDecoratorNatives(Globals)
+	defineMacroNatives(Globals)
+	defineSetNatives(Globals)
+	definePersistentNatives(Globals)
 
 	return Globals
 }
@@ -144,6 +362,9 @@ func (i *Interpreter) VisitLiteral(exp *expr.Literal) interface{} {
 	if exp.Value == token.BREAK {
 		panic(ErrBreak{})
 	}
+	if exp.Value == token.CONTINUE {
+		panic(ErrContinue{})
+	}
 	return exp.Value
 }
 
@@ -155,60 +376,63 @@ func (i *Interpreter) VisitBinary(exp *expr.Binary) interface{} {
 	left := i.Evaluate(exp.Left)
 	right := i.Evaluate(exp.Right)
 
+	if li, ok := left.(*LoxInstance); ok {
+		if v, ok := i.callOperator(li, exp.Operator, right); ok {
+			return v
+		}
+	} else if ri, ok := right.(*LoxInstance); ok {
+		if v, ok := i.callReflectedOperator(ri, exp.Operator, left); ok {
+			return v
+		}
+	}
+
 	switch exp.Operator.TokenType {
 	case token.BANG_EQUAL:
-		return !isEqual(left, right)
+		return !i.isEqual(left, right)
 	case token.EQUAL_EQUAL:
-		return isEqual(left, right)
+		return i.isEqual(left, right)
 	case token.GREATER:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv > rv
 		}
-		fmt.Println("Tried to VisitBinary.GREATER and failed: ", left, right)
 	case token.GREATER_EQUAL:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv >= rv
 		}
-		fmt.Println("Tried to VisitBinary.GREATER_EQUAL and failed: ", left, right)
 	case token.LESS:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv < rv
 		}
-		fmt.Println("Tried to VisitBinary.LESS and failed: ", left, right)
 	case token.LESS_EQUAL:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv <= rv
 		}
-		fmt.Println("Tried to VisitBinary.LESS_EQUAL and failed: ", left, right)
 	case token.MINUS:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv - rv
 		}
-		fmt.Println("Tried to VisitBinary.MINUS and failed: ", left, right)
 	case token.SLASH:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv / rv
 		}
-		fmt.Println("Tried to VisitBinary.SLASH and failed: ", left, right)
 	case token.STAR:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
 		if rok == nil && lok == nil {
 			return lv * rv
 		}
-		fmt.Println("Tried to VisitBinary.STAR and failed: ", left, right)
 	case token.PLUS:
 		lv, lok := toFloat(left)
 		rv, rok := toFloat(right)
@@ -221,33 +445,146 @@ func (i *Interpreter) VisitBinary(exp *expr.Binary) interface{} {
 		if rok2 && lok2 {
 			return lv2 + rv2
 		}
-		fmt.Println("Tried to VisitBinary.PLUS and failed: ", left, right)
 	}
 
-	return nil
+	panic(errors.New(fmt.Sprintf("%v: cannot apply '%v' to a %v and a %v", exp.Operator, exp.Operator.Lexeme, typeName(left), typeName(right))))
 }
 
 func (i *Interpreter) VisitCall(call *expr.Call) interface{} {
 	callee := i.Evaluate(call.Callee)
-	arguments := make([]interface{}, 0)
-	for _, arg := range call.Arguments {
-		arguments = append(arguments, i.Evaluate(arg))
-	}
+	arguments := i.evaluateArguments(call.Arguments)
+	return i.checkCallable(callee, arguments, call).Call(i, arguments)
+}
 
+func (i *Interpreter) checkCallable(callee interface{}, arguments []interface{}, call *expr.Call) LoxCallable {
 	fxn, ok := callee.(LoxCallable)
 	if !ok {
 		panic(errors.New(fmt.Sprintf("%v: Can only call functions and classes", call.Paren)))
 	}
-	if len(arguments) != fxn.Arity() {
+	if len(arguments) > 255 {
+		panic(errors.New(fmt.Sprintf("%v: cannot have more than 255 args in function call", call.Paren)))
+	}
+	if !arityMatches(fxn, len(arguments)) {
 		panic(errors.New(fmt.Sprintf("Expected %v arguments, got %v arguments", fxn.Arity(), len(arguments))))
 	}
-	return fxn.Call(i, arguments)
+	return fxn
+}
+
+// evaluateArguments evaluates call arguments and list elements, expanding any `...spread` in place
+func (i *Interpreter) evaluateArguments(args []expr.ExprInterface) []interface{} {
+	values := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if spread, ok := arg.(*expr.Spread); ok {
+			values = append(values, i.spreadValues(spread)...)
+		} else {
+			values = append(values, i.Evaluate(arg))
+		}
+	}
+	return values
+}
+
+func (i *Interpreter) spreadValues(spread *expr.Spread) []interface{} {
+	values := make([]interface{}, 0)
+	iter := i.iterate(i.Evaluate(spread.Expression), spread.Operator)
+	for v, ok := iter.Next(); ok; v, ok = iter.Next() {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (i *Interpreter) VisitSpread(spread *expr.Spread) interface{} {
+	panic(errors.New(fmt.Sprintf("%v: '...' is only allowed in calls and collection literals", spread.Operator)))
+}
+
+func (i *Interpreter) VisitList(list *expr.List) interface{} {
+	return &LoxList{Elements: i.evaluateArguments(list.Elements)}
+}
+
+func (i *Interpreter) VisitMap(m *expr.Map) interface{} {
+	loxMap := MakeLoxMap()
+	for ind, key := range m.Keys {
+		if spread, ok := key.(*expr.Spread); ok {
+			other, ok := i.Evaluate(spread.Expression).(*LoxMap)
+			if !ok {
+				panic(errors.New(fmt.Sprintf("%v: can only spread maps into a map literal", spread.Operator)))
+			}
+			for _, k := range other.Keys {
+				v, _ := other.Get(k)
+				loxMap.Set(k, v)
+			}
+			continue
+		}
+		k := i.Evaluate(key)
+		if !isHashable(k) {
+			panic(errors.New(fmt.Sprintf("%v: a %v cannot be used as a map key", m.Brace, typeName(k))))
+		}
+		loxMap.Set(k, i.Evaluate(m.Values[ind]))
+	}
+	return loxMap
+}
+
+func (i *Interpreter) VisitIndex(index *expr.Index) interface{} {
+	object := i.Evaluate(index.Object)
+	key := i.Evaluate(index.Index)
+
+	switch o := object.(type) {
+	case *LoxList:
+		if r, ok := key.(LoxRange); ok {
+			elements := make([]interface{}, 0)
+			for _, ind := range slice(r, len(o.Elements), index.Bracket) {
+				elements = append(elements, o.Elements[ind])
+			}
+			return &LoxList{Elements: elements}
+		}
+		return o.Elements[toIndex(key, len(o.Elements), index.Bracket)]
+	case string:
+		if r, ok := key.(LoxRange); ok {
+			chars := make([]byte, 0)
+			for _, ind := range slice(r, len(o), index.Bracket) {
+				chars = append(chars, o[ind])
+			}
+			return string(chars)
+		}
+		return string(o[toIndex(key, len(o), index.Bracket)])
+	case *LoxMap:
+		if !isHashable(key) {
+			panic(errors.New(fmt.Sprintf("%v: a %v cannot be used as a map key", index.Bracket, typeName(key))))
+		}
+		// missing keys evaluate to nil
+		v, _ := o.Get(key)
+		return v
+	case *LoxPersistentList:
+		return o.index(key, index.Bracket)
+	case *LoxPersistentMap:
+		v, _ := o.lookup(key)
+		return v
+	case *LoxInstance:
+		if method, ok := o.method("__index__"); ok {
+			return method.Call(i, []interface{}{key})
+		}
+	}
+	panic(errors.New(fmt.Sprintf("%v: only lists, maps, persistent collections, strings and instances with __index__ can be indexed", index.Bracket)))
+}
+
+func toIndex(key interface{}, length int, bracket token.Token) int {
+	f, err := toFloat(key)
+	if err != nil {
+		panic(errors.New(fmt.Sprintf("%v: index must be a whole number, got a %v", bracket, typeName(key))))
+	}
+	if f != float64(int(f)) {
+		panic(errors.New(fmt.Sprintf("%v: index must be a whole number, got %v", bracket, key)))
+	}
+	if int(f) < 0 || int(f) >= length {
+		panic(errors.New(fmt.Sprintf("%v: index %v out of range", bracket, key)))
+	}
+	return int(f)
 }
 
 func (i *Interpreter) VisitGet(get *expr.Get) interface{} {
+	checkPrivateAccess(get.Object, get.Name)
 	obj := i.Evaluate(get.Object)
-	if li, ok := obj.(LoxInstance); ok {
-		return li.Get(get.Name)
+	if lo, ok := obj.(LoxObject); ok {
+		return lo.Get(get.Name)
 	}
 
 	panic(fmt.Sprintf("%v: only instances have properties", get.Name))
@@ -296,13 +633,27 @@ func (i *Interpreter) VisitExpression(stmt *expr.Expression) interface{} {
 
 func (i *Interpreter) VisitFunction(fxn *expr.Function) interface{} {
 	loxFxn := LoxFunction{Declaration: *fxn, Closure: i.env}
-	i.env.Define(fxn.Name.Lexeme, loxFxn)
+	if len(fxn.Decorators) > 0 {
+		i.define(fxn.Name.Lexeme, i.decorate(loxFxn, i.evaluateDecorators(fxn), fxn.Name))
+		return nil
+	}
+	i.define(fxn.Name.Lexeme, loxFxn)
 	return nil
 }
 
+// define declares a name in the current environment, which fails for a global constant
+func (i *Interpreter) define(name string, value interface{}) {
+	if err := i.env.Define(name, value); err != nil {
+		panic(err)
+	}
+}
+
 func (i *Interpreter) VisitPrint(stmt *expr.Print) interface{} {
+	if i.restricted {
+		panic(errors.New("cannot print in code that runs before the program"))
+	}
 	value := i.Evaluate(stmt.Expression)
-	fmt.Println(value)
+	fmt.Println(i.Stringify(value))
 	return nil
 }
 
@@ -313,11 +664,38 @@ func (i *Interpreter) VisitVar(stmt *expr.Var) interface{} {
 		value = i.Evaluate(stmt.Initializer)
 	}
 
-	i.env.Define(stmt.Name.Lexeme, value)
+	if !stmt.Constant {
+		i.define(stmt.Name.Lexeme, value)
+	} else if err := i.env.DefineConst(stmt.Name.Lexeme, value); err != nil {
+		panic(err)
+	}
 	return nil
 }
 
+func (i *Interpreter) VisitAssert(stmt *expr.Assert) interface{} {
+	if i.DisableAssertions {
+		return nil
+	}
+	if ok, _ := toTruthy(i.Evaluate(stmt.Condition)); ok {
+		return nil
+	}
+	msg := fmt.Sprintf("line %v: assertion failed: %v", stmt.Keyword.Line, stmt.Source)
+	if stmt.Message != nil {
+		msg += ": " + i.Stringify(i.Evaluate(stmt.Message))
+	}
+	panic(errors.New(msg))
+}
+
 func (i *Interpreter) VisitReturn(ret *expr.Return) interface{} {
+	if call, ok := ret.Value.(*expr.Call); ok && i.canTailCall() {
+		callee := i.Evaluate(call.Callee)
+		arguments := i.evaluateArguments(call.Arguments)
+		fxn := i.checkCallable(callee, arguments, call)
+		if lf, ok := fxn.(LoxFunction); ok && !lf.Declaration.Generator {
+			panic(ErrReturn{tailCall: &tailCall{fxn: lf, arguments: arguments}})
+		}
+		panic(ErrReturn{Value: fxn.Call(i, arguments)})
+	}
 	if ret.Value != nil {
 		value := i.Evaluate(ret.Value)
 		panic(ErrReturn{Value: value})
@@ -325,33 +703,43 @@ func (i *Interpreter) VisitReturn(ret *expr.Return) interface{} {
 	panic(ErrReturn{})
 }
 
+// the returning function's frame can be dropped before a call in tail position runs, unless it
+// still has deferred calls to run after the call, or it's a generator, which discards return values
+func (i *Interpreter) canTailCall() bool {
+	return i.generator == nil && i.deferred != nil && len(*i.deferred) == 0
+}
+
 func (i *Interpreter) VisitVariable(exp *expr.Variable) interface{} {
-	i.LookupVariable(exp.Name, exp)
-	v, err := i.env.Get(exp.Name.Lexeme)
+	v, err := i.LookupVariable(exp.Name, exp)
 	if err == nil {
 		return v
 	}
 	panic(err)
 }
 
-func (i *Interpreter) LookupVariable(name token.Token, exp *expr.Variable) (interface{}, error) {
-	distance := i.Locals[exp]
+func (i *Interpreter) VisitThis(exp *expr.This) interface{} {
+	v, err := i.LookupVariable(exp.Keyword, exp)
+	if err == nil {
+		return v
+	}
+	panic(err)
+}
 
-	if distance != 0 {
+// variables the resolver didn't see (globals, or code that was never resolved) are looked up dynamically
+func (i *Interpreter) LookupVariable(name token.Token, exp expr.ExprInterface) (interface{}, error) {
+	if distance, ok := i.Locals[exp]; ok {
 		return i.env.GetAt(distance, name.Lexeme), nil
-	} else {
-		return Globals.Get(name.Lexeme)
 	}
+	return i.env.Get(name.Lexeme)
 }
 
 func (i *Interpreter) VisitAssign(exp *expr.Assign) interface{} {
 	value := i.Evaluate(exp.Value)
 
-	distance := i.Locals[exp]
-	if distance != 0 {
+	if distance, ok := i.Locals[exp]; ok {
 		i.env.AssignAt(distance, exp.Name, value)
-	} else {
-		Globals.Assign(exp.Name.Lexeme, value)
+	} else if _, err := i.env.Assign(exp.Name.Lexeme, value); err != nil {
+		panic(err)
 	}
 
 	return value
@@ -373,7 +761,7 @@ func (i *Interpreter) Execute(stmt expr.StmtInterface) {
 }
 
 func (i *Interpreter) Resolve(exp expr.ExprInterface, depth int) {
-	i.Locals[&exp] = depth
+	i.Locals[exp] = depth
 }
 
 func (i *Interpreter) VisitBlock(block *expr.Block) interface{} {
@@ -382,24 +770,79 @@ func (i *Interpreter) VisitBlock(block *expr.Block) interface{} {
 }
 
 func (i *Interpreter) VisitClass(class *expr.Class) interface{} {
-	i.env.Define(class.Name.Lexeme, nil)
+	i.define(class.Name.Lexeme, nil)
 
 	methods := make(map[string]LoxFunction)
+	decorators := make(map[string][]interface{})
+	traits := make([]*LoxTrait, 0, len(class.Traits))
+	// trait methods go in first so the class's own methods override them
+	for _, t := range class.Traits {
+		trait, ok := i.Evaluate(t).(*LoxTrait)
+		if !ok {
+			panic(errors.New(fmt.Sprintf("%v: can only use traits with 'with'", t.(*expr.Variable).Name)))
+		}
+		traits = append(traits, trait)
+		for name, method := range trait.Methods {
+			methods[name] = method
+		}
+		for name, d := range trait.Decorators {
+			decorators[name] = d
+		}
+	}
 	for _, method := range class.Methods {
 		decl, ok := method.(*expr.Function)
 		if ok {
 			function := LoxFunction{Declaration: *decl, Closure: i.env}
 			methods[decl.Name.Lexeme] = function
+			delete(decorators, decl.Name.Lexeme)
+			if len(decl.Decorators) > 0 {
+				decorators[decl.Name.Lexeme] = i.evaluateDecorators(decl)
+			}
 		}
 	}
 
-	klass := LoxClass{Name: class.Name.Lexeme, Methods: methods}
+	fields := make([]*expr.Var, 0, len(class.Fields))
+	for _, field := range class.Fields {
+		fields = append(fields, field.(*expr.Var))
+	}
+
+	klass := &LoxClass{Name: class.Name.Lexeme, Methods: methods, Traits: traits, Fields: fields, Closure: i.env, Sealed: class.Sealed, Decorated: i.decorateMethods(methods, decorators)}
 	i.env.Assign(klass.Name, klass)
 	return nil
 }
 
+func (i *Interpreter) VisitRecord(record *expr.Record) interface{} {
+	methods := make(map[string]LoxFunction)
+	for _, method := range record.Methods {
+		if decl, ok := method.(*expr.Function); ok {
+			methods[decl.Name.Lexeme] = LoxFunction{Declaration: *decl, Closure: i.env}
+		}
+	}
+	fields := make([]string, 0, len(record.Fields))
+	for _, field := range record.Fields {
+		fields = append(fields, field.Lexeme)
+	}
+
+	klass := &LoxClass{Name: record.Name.Lexeme, Methods: methods, RecordFields: fields, Decorated: i.decorateMethods(methods, i.methodDecorators(record.Methods))}
+	i.define(record.Name.Lexeme, klass)
+	return nil
+}
+
+func (i *Interpreter) VisitTrait(trait *expr.Trait) interface{} {
+	methods := make(map[string]LoxFunction)
+	for _, method := range trait.Methods {
+		if decl, ok := method.(*expr.Function); ok {
+			methods[decl.Name.Lexeme] = LoxFunction{Declaration: *decl, Closure: i.env}
+		}
+	}
+
+	i.define(trait.Name.Lexeme, &LoxTrait{Name: trait.Name.Lexeme, Methods: methods, Decorators: i.methodDecorators(trait.Methods)})
+	return nil
+}
+
 func (i *Interpreter) ExecuteBlock(stmts []expr.StmtInterface, env environment.Environment) {
-	i2 := Interpreter{env: env}
+	i2 := *i
+	i2.env = env
 	for _, stmt := range stmts {
 		(&i2).Execute(stmt)
 	}
@@ -432,8 +875,9 @@ func (i *Interpreter) VisitLogical(logical *expr.Logical) interface{} {
 }
 
 func (i *Interpreter) VisitSet(set *expr.Set) interface{} {
+	checkPrivateAccess(set.Object, set.Name)
 	object := i.Evaluate(set.Object)
-	li, ok := object.(LoxInstance)
+	li, ok := object.(*LoxInstance)
 	if !ok {
 		panic(fmt.Sprintf("%v: only instances have fields", set.Name))
 	}
@@ -454,12 +898,63 @@ func (i *Interpreter) VisitWhile(stmt *expr.While) interface{} {
 	v, _ := toTruthy(i.Evaluate(stmt.Condition))
 	// if a stmt is a break, stop looping
 	for v {
-		i.Execute(stmt.Body)
+		continuable(func() { i.Execute(stmt.Body) })
+		if stmt.Increment != nil {
+			i.Evaluate(stmt.Increment)
+		}
 		v, _ = toTruthy(i.Evaluate(stmt.Condition))
 	}
 	return nil
 }
 
+func (i *Interpreter) VisitDoWhile(stmt *expr.DoWhile) interface{} {
+	defer func() {
+		if err := recover(); err != nil {
+			if _, ok := err.(ErrBreak); !ok {
+				panic(err)
+			}
+		}
+	}()
+	for v := true; v; v, _ = toTruthy(i.Evaluate(stmt.Condition)) {
+		continuable(func() { i.Execute(stmt.Body) })
+	}
+	return nil
+}
+
+// continuable runs one iteration of a loop's body, which `continue` ends early
+func continuable(iteration func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			if _, ok := err.(ErrContinue); !ok {
+				panic(err)
+			}
+		}
+	}()
+	iteration()
+}
+
+func (i *Interpreter) VisitForIn(stmt *expr.ForIn) interface{} {
+	iter := i.iterate(i.Evaluate(stmt.Iterable), stmt.Name)
+	defer func() {
+		if err := recover(); err != nil {
+			// a generator abandoned by `break` (or an error) is closed so its goroutine can exit
+			if g, ok := iter.(*LoxGenerator); ok {
+				g.Close()
+			}
+			if _, ok := err.(ErrBreak); !ok {
+				panic(err)
+			}
+		}
+	}()
+	for v, ok := iter.Next(); ok; v, ok = iter.Next() {
+		// each iteration gets a fresh environment, so closures capture that iteration's value
+		env := environment.MakeEnvironment(&i.env)
+		env.Define(stmt.Name.Lexeme, v)
+		continuable(func() { i.ExecuteBlock([]expr.StmtInterface{stmt.Body}, env) })
+	}
+	return nil
+}
+
 func toFloat(i interface{}) (float64, error) {
 	switch v := i.(type) {
 	case float64:
@@ -484,6 +979,61 @@ func toTruthy(i interface{}) (bool, error) {
 	return true, nil
 }
 
-func isEqual(l interface{}, r interface{}) bool {
+// isEqual uses the left operand's `__eq__` method when it has one. records are equal when
+// they are of the same record type and their fields are equal
+func (i *Interpreter) isEqual(l interface{}, r interface{}) bool {
+	if li, ok := l.(*LoxInstance); ok {
+		if eq, ok := li.method("__eq__"); ok {
+			v, _ := toTruthy(eq.Call(i, []interface{}{r}))
+			return v
+		}
+		if ri, ok := r.(*LoxInstance); ok && li.Klass.isRecord() && li.Klass == ri.Klass {
+			for _, field := range li.Klass.RecordFields {
+				if !i.isEqual(li.Fields[field], ri.Fields[field]) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if equal, ok := i.persistentEqual(l, r); ok {
+		return equal
+	}
+	if ls, ok := l.(*LoxSet); ok {
+		if rs, ok := r.(*LoxSet); ok {
+			return ls.equals(rs)
+		}
+	}
+	if lf, ok := l.(LoxFunction); ok {
+		rf, ok := r.(LoxFunction)
+		return ok && sameFunction(lf, rf)
+	}
+	// other values holding slices, maps or funcs, e.g. natives, would make == panic
+	if t := reflect.TypeOf(l); t != nil && t == reflect.TypeOf(r) && !t.Comparable() {
+		return false
+	}
 	return l == r
 }
+
+// sameFunction reports whether two functions come from the same declaration and close over the
+// same environment. binding a method makes a new environment each time, so `a.m == a.m` compares
+// the bound instance and the environment the method was declared in instead
+func sameFunction(l LoxFunction, r LoxFunction) bool {
+	ld, rd := l.Declaration, r.Declaration
+	if ld.Name != rd.Name || len(ld.Body) != len(rd.Body) || reflect.ValueOf(ld.Body).Pointer() != reflect.ValueOf(rd.Body).Pointer() {
+		return false
+	}
+	return sameClosure(l.Closure, r.Closure)
+}
+
+func sameClosure(l environment.Environment, r environment.Environment) bool {
+	if reflect.ValueOf(l.Values).Pointer() == reflect.ValueOf(r.Values).Pointer() {
+		return true
+	}
+	lthis, lok := l.Values["this"]
+	rthis, rok := r.Values["this"]
+	if !lok || !rok || len(l.Values) != 1 || len(r.Values) != 1 || lthis != rthis {
+		return false
+	}
+	return l.Enclosing != nil && r.Enclosing != nil && sameClosure(*l.Enclosing, *r.Enclosing)
+}
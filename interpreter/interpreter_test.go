@@ -1,7 +1,10 @@
 package interpreter
 
 import (
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/weiser/lox/expr"
 	"github.com/weiser/lox/parser"
@@ -357,3 +360,1302 @@ func TestClassInstanceMethods(t *testing.T) {
 		t.Errorf("expected a = 1, instead a = %v", a)
 	}
 }
+
+func TestSpreadCallArguments(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun add(a, b, c) { return a + b + c; }
+	fun wrap(...args) { return add(...args); }
+
+	var a = wrap(1, 2, 3);
+	var b = add(1, ...[2, 3]);
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 6 {
+		t.Errorf("expected a = 6, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(float64); b != 6 {
+		t.Errorf("expected b = 6, instead b = %v", b)
+	}
+}
+
+func TestSpreadCollectionLiterals(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var a = [1, 2];
+	var b = [...a, 3, ...a];
+	var defaults = {"x": 1, "y": 2};
+	var m = {...defaults, "y": 3};
+	var y = m["y"];
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("b")
+	if b := o.(*LoxList); b.String() != "[1, 2, 3, 1, 2]" {
+		t.Errorf("expected b = [1, 2, 3, 1, 2], instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("m")
+	if m := o.(*LoxMap); m.String() != "{x: 1, y: 3}" {
+		t.Errorf("expected m = {x: 1, y: 3}, instead m = %v", m)
+	}
+	o, _ = (&i).env.Get("y")
+	if y := o.(float64); y != 3 {
+		t.Errorf("expected y = 3, instead y = %v", y)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun* count(n) {
+		var i = 0;
+		while (i < n) {
+			yield i;
+			i = i + 1;
+		}
+	}
+
+	var g = count(2);
+	var a = g.next();
+	var b = g.hasNext();
+	var c = g.next();
+	var d = g.hasNext();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 0 {
+		t.Errorf("expected a = 0, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(bool); !b {
+		t.Errorf("expected b = true, instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := o.(float64); c != 1 {
+		t.Errorf("expected c = 1, instead c = %v", c)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := o.(bool); d {
+		t.Errorf("expected d = false, instead d = %v", d)
+	}
+}
+
+func TestAbandonedGeneratorsAreClosed(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var closed = 0;
+	fun close() { closed = closed + 1; }
+	fun* naturals() {
+		defer close();
+		var i = 0;
+		while (true) {
+			yield i;
+			i = i + 1;
+		}
+	}
+	for (var k = 0; k < 20; k = k + 1) naturals().next();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+	before := runtime.NumGoroutine()
+	(&i).Interpret(stmts)
+
+	// finalizers run on their own goroutine some time after a collection
+	for attempt := 0; attempt < 100; attempt++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		closeAbandoned()
+		if runtime.NumGoroutine() <= before {
+			break
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected the 20 abandoned generators to be closed, %v goroutines are left", after-before)
+	}
+	if o, _ := (&i).env.Get("closed"); o != 0.0 {
+		t.Errorf("expected abandoned generators not to run their deferred calls, %v did", o)
+	}
+}
+
+func TestGeneratorAlreadyRunning(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var g;
+	fun* gen() { yield g.next(); }
+	g = gen();
+	g.next();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok {
+			t.Fatalf("expected calling next() inside the generator to fail")
+		}
+		if !strings.Contains(err.Error(), "generator gen is already running") {
+			t.Errorf("unexpected error %q", err.Error())
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestGeneratorIsLazy(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var calls = 0;
+	fun* naturals() {
+		var i = 0;
+		while (true) {
+			calls = calls + 1;
+			yield i;
+			i = i + 1;
+		}
+	}
+
+	var g = naturals();
+	var before = calls;
+	g.next();
+	var a = g.next();
+	g.close();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("before")
+	if before := o.(float64); before != 0 {
+		t.Errorf("expected the generator not to run before next(), ran %v times", before)
+	}
+	o, _ = (&i).env.Get("a")
+	if a := o.(float64); a != 1 {
+		t.Errorf("expected a = 1, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("calls")
+	if calls := o.(float64); calls != 2 {
+		t.Errorf("expected calls = 2, instead calls = %v", calls)
+	}
+}
+
+func TestForInStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun* letters() { yield "a"; yield "b"; yield "c"; }
+	var a = 0;
+	for (var x in [1, 2, 3]) {
+		a = a + x;
+	}
+	var b = "";
+	for (k in {"x": 1, "y": 2}) b = b + k;
+	var c = "";
+	for (var l in letters()) {
+		if (l == "c") break;
+		c = c + l;
+	}
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 6 {
+		t.Errorf("expected a = 6, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(string); b != "xy" {
+		t.Errorf("expected b = 'xy', instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := o.(string); c != "ab" {
+		t.Errorf("expected c = 'ab', instead c = %v", c)
+	}
+}
+
+func TestForInUserIterator(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Countdown {
+		init(n) { this.n = n; }
+		hasNext() { return this.n > 0; }
+		next() {
+			this.n = this.n - 1;
+			return this.n + 1;
+		}
+	}
+	class Twice {
+		init(n) { this.n = n; }
+		iterator() { return Countdown(this.n * 2); }
+	}
+	var a = "";
+	for (var i in Twice(2)) {
+		a = a + "x";
+	}
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(string); a != "xxxx" {
+		t.Errorf("expected a = 'xxxx', instead a = %v", a)
+	}
+}
+
+func TestRange(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var a = 0;
+	for (var i in 1..10) a = a + i;
+	var b = 0;
+	for (var i in (0..<10).step(3)) b = b + i;
+	var c = (0..<10).contains(10);
+	var d = [10, 20, 30, 40][1..2];
+	var e = "hello"[1..<4];
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 55 {
+		t.Errorf("expected a = 55, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(float64); b != 18 {
+		t.Errorf("expected b = 18, instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := o.(bool); c {
+		t.Errorf("expected c = false, instead c = %v", c)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := o.(*LoxList); d.String() != "[20, 30]" {
+		t.Errorf("expected d = [20, 30], instead d = %v", d)
+	}
+	o, _ = (&i).env.Get("e")
+	if e := o.(string); e != "ell" {
+		t.Errorf("expected e = 'ell', instead e = %v", e)
+	}
+}
+
+func TestAssignToGlobalConst(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	const a = 1;
+	a = 2;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("expected assigning to a const to fail")
+		}
+		o, _ := (&i).env.Get("a")
+		if a := o.(float64); a != 1 {
+			t.Errorf("expected a = 1, instead a = %v", a)
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestRedeclareGlobalConst(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	const a = 1;
+	var a = 2;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("expected redeclaring a const to fail")
+		}
+		o, _ := (&i).env.Get("a")
+		if a := o.(float64); a != 1 {
+			t.Errorf("expected a = 1, instead a = %v", a)
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestEnum(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	enum Color { Red, Green, Blue }
+	enum Light { Red, Off }
+	var a = Color.Green;
+	var b = a == Color.Green;
+	var c = Color.Red == Light.Red;
+	var d = a.name + " " + Color.values()[2].name;
+	var e = a.ordinal;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(*LoxEnumValue); a.String() != "Color.Green" {
+		t.Errorf("expected a = Color.Green, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(bool); !b {
+		t.Errorf("expected b = true, instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := o.(bool); c {
+		t.Errorf("expected members of different enums to differ, c = %v", c)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := o.(string); d != "Green Blue" {
+		t.Errorf("expected d = 'Green Blue', instead d = %v", d)
+	}
+	o, _ = (&i).env.Get("e")
+	if e := o.(float64); e != 1 {
+		t.Errorf("expected e = 1, instead e = %v", e)
+	}
+}
+
+func TestTraits(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	trait Comparable {
+		lessThan(o) { return this.compare(o) < 0; }
+		describe() { return "comparable"; }
+	}
+	class Money with Comparable {
+		init(cents) { this.cents = cents; }
+		compare(o) { return this.cents - o.cents; }
+		describe() { return "money"; }
+	}
+	var a = Money(1).lessThan(Money(2));
+	var b = Money(1).describe();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(bool); !a {
+		t.Errorf("expected a = true, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(string); b != "money" {
+		t.Errorf("expected the class's method to override the trait's, b = %v", b)
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Vec {
+		init(x, y) { this.x = x; this.y = y; }
+		__add__(o) { return Vec(this.x + o.x, this.y + o.y); }
+		__eq__(o) { return this.x == o.x and this.y == o.y; }
+		__lt__(o) { return this.x < o.x; }
+		__rmul__(k) { return Vec(this.x * k, this.y * k); }
+		__index__(i) { if (i == 0) return this.x; return this.y; }
+	}
+	var v = Vec(1, 2) + Vec(3, 4);
+	var a = v[1];
+	var g = (2 * Vec(1, 2))[1];
+	var b = v == Vec(4, 6);
+	var c = v != Vec(4, 6);
+	var d = Vec(1, 1) < Vec(2, 2);
+	class P {}
+	var p = P();
+	var e = p == p;
+	var f = p == P();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 6 {
+		t.Errorf("expected a = 6, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("g")
+	if g := o.(float64); g != 4 {
+		t.Errorf("expected the right operand's __rmul__ to give g = 4, instead g = %v", g)
+	}
+	for name, expected := range map[string]bool{"b": true, "c": false, "d": true, "e": true, "f": false} {
+		o, _ = (&i).env.Get(name)
+		if v := o.(bool); v != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, v)
+		}
+	}
+}
+
+func TestFunctionEquality(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun f() {}
+	fun make() { fun g() {} return g; }
+	class A { m() {} }
+	var a = A();
+	var b = f == f;
+	var c = make() == make();
+	var d = a.m == a.m;
+	var e = a.m == A().m;
+	var h = gensym == gensym;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	for name, expected := range map[string]bool{"b": true, "c": false, "d": true, "e": false, "h": false} {
+		o, _ := (&i).env.Get(name)
+		if v := o.(bool); v != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, v)
+		}
+	}
+}
+
+func TestBinaryOperandErrors(t *testing.T) {
+	for _, src := range []string{`var a = "a" - 1;`, `var a = 1 + "a";`, `class P {} var a = 1 < P();`} {
+		scanner := scanner.MakeScanner(src)
+		parser := parser.Parser{Tokens: scanner.ScanTokens()}
+		stmts, err := parser.Parse()
+		if err != nil {
+			t.Errorf("didn't parse, %v", err)
+		}
+		i := MakeInterpreter()
+
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected %q to fail", src)
+				}
+			}()
+			(&i).Interpret(stmts)
+		}()
+	}
+}
+
+func TestStringify(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun f() {}
+	class A { toString() { return "an A"; } }
+	class B {}
+	var a = A();
+	var b = B();
+	var l = [1.5, nil, a, true];
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	get := func(name string) interface{} {
+		o, _ := (&i).env.Get(name)
+		return o
+	}
+	expectations := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{1000000.0, "1000000"},
+		{get("f"), "<fn f>"},
+		{get("A"), "<class A>"},
+		{get("a"), "an A"},
+		{get("b"), "B instance"},
+		{get("l"), "[1.5, nil, an A, true]"},
+	}
+	for _, e := range expectations {
+		if s := (&i).Stringify(e.value); s != e.expected {
+			t.Errorf("expected %v, got %v", e.expected, s)
+		}
+	}
+}
+
+func TestReflectionNatives(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Point { init(x, y) { this.x = x; this.y = y; } norm() { return 0; } }
+	class Other {}
+	var p = Point(1, 2);
+	setField(p, "z", getField(p, "y") + 1);
+	var a = type(p) + " " + type(1) + " " + type(nil) + " " + className(p);
+	var b = isInstance(p, Point) and !isInstance(p, Other) and !isInstance(1, Point);
+	var c = fields(p);
+	var d = methods(Point);
+	var e = hasField(p, "z") and !hasField(p, "w");
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(string); a != "Point Number Nil Point" {
+		t.Errorf("expected a = 'Point Number Nil Point', instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(bool); !b {
+		t.Errorf("expected b = true, instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := (&i).Stringify(o); c != "[x, y, z]" {
+		t.Errorf("expected c = [x, y, z], instead c = %v", c)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := (&i).Stringify(o); d != "[init, norm]" {
+		t.Errorf("expected d = [init, norm], instead d = %v", d)
+	}
+	o, _ = (&i).env.Get("e")
+	if e := o.(bool); !e {
+		t.Errorf("expected e = true, instead e = %v", e)
+	}
+}
+
+func TestIsOperator(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	trait Shape {}
+	class Point with Shape {}
+	class Other {}
+	enum Color { Red }
+	var p = Point();
+	var a = p is Point and p is Shape and !(p is Other);
+	var b = "s" is String and 1 is Number and !(1 is String) and nil is Nil;
+	var c = Color.Red is Color and !(p is Color);
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	for _, name := range []string{"a", "b", "c"} {
+		o, _ := (&i).env.Get(name)
+		if v := o.(bool); !v {
+			t.Errorf("expected %v = true, instead %v = %v", name, name, v)
+		}
+	}
+}
+
+func TestPrivateMembers(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Account {
+		init(b) { this.#balance = b; this.owner = "me"; }
+		#check(n) { return n <= this.#balance; }
+		withdraw(n) { if (this.#check(n)) this.#balance = this.#balance - n; return this.#balance; }
+	}
+	var account = Account(10);
+	var a = account.withdraw(3);
+	var b = fields(account);
+	var c = methods(Account);
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 7 {
+		t.Errorf("expected a = 7, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := (&i).Stringify(o); b != "[owner]" {
+		t.Errorf("expected private fields to be hidden, b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := (&i).Stringify(o); c != "[init, withdraw]" {
+		t.Errorf("expected private methods to be hidden, c = %v", c)
+	}
+}
+
+func TestPrivateMemberOutsideThis(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Account { init(b) { this.#balance = b; } }
+	print Account(1).#balance;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected reading a private field from outside to fail")
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestFieldDeclarations(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var counter = 0;
+	class P {
+		var x = 0;
+		var y = this.x + 1;
+		var #id = counter = counter + 1;
+		var items = [];
+		init(x) { this.x = x; }
+		id() { return this.#id; }
+	}
+	var p = P(5);
+	var q = P(6);
+	var a = p.x + p.y;
+	var b = q.id();
+	var c = p.items == q.items;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 6 {
+		t.Errorf("expected field initializers to run before init, a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(float64); b != 2 {
+		t.Errorf("expected b = 2, instead b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c := o.(bool); c {
+		t.Errorf("expected each instance to get its own list, c = %v", c)
+	}
+}
+
+func TestSealedClass(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	sealed class S {
+		var length = 0;
+		init() { this.length = 3; }
+	}
+	var s = S();
+	s.lenght = 4;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected setting an undeclared field on a sealed instance to fail")
+		}
+		o, _ := (&i).env.Get("s")
+		if length := o.(*LoxInstance).Fields["length"]; length != 3.0 {
+			t.Errorf("expected length = 3, instead length = %v", length)
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestRecord(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	record Point(x, y) {
+		norm() { return this.x * this.x + this.y * this.y; }
+	}
+	var p = Point(1, 2);
+	var a = p.norm();
+	var b = p == Point(1, 2) and p != Point(2, 1);
+	var c = {p: "found"}[Point(1, 2)];
+	var d = p;
+	var e = p.toString();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 5 {
+		t.Errorf("expected a = 5, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(bool); !b {
+		t.Errorf("expected records to compare by value, b = %v", b)
+	}
+	o, _ = (&i).env.Get("c")
+	if c, _ := o.(string); c != "found" {
+		t.Errorf("expected equal records to be the same map key, c = %v", o)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := (&i).Stringify(o); d != "Point(x: 1, y: 2)" {
+		t.Errorf("expected d = Point(x: 1, y: 2), instead d = %v", d)
+	}
+	o, _ = (&i).env.Get("e")
+	if e, _ := o.(string); e != "Point(x: 1, y: 2)" {
+		t.Errorf("expected e = Point(x: 1, y: 2), instead e = %v", o)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Box { init(v) { this.v = v; } }
+	var b = freeze(Box(Box(1)));
+	b.v.v = 3;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected setting a field of a deeply frozen instance to fail")
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestDecorators(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var calls = 0;
+	@memoize
+	fun fib(n) { calls = calls + 1; if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+	var a = fib(30);
+	fun twice(fn) { fun g(x) { return fn(fn(x)); } return g; }
+	fun inc(fn) { fun g(x) { return fn(x) + 1; } return g; }
+	@twice @inc
+	fun h(x) { return x * 2; }
+	var b = h(1);
+	class C {
+		init(k) { this.k = k; this.n = 0; }
+		@memoize
+		slow(x) { this.n = this.n + 1; return x * this.k; }
+	}
+	var c = C(3);
+	var d = c.slow(2) + c.slow(2) + C(4).slow(2);
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("a")
+	if a := o.(float64); a != 832040 {
+		t.Errorf("expected a = 832040, instead a = %v", a)
+	}
+	o, _ = (&i).env.Get("calls")
+	if calls := o.(float64); calls != 31 {
+		t.Errorf("expected fib's body to run once per n, ran %v times", calls)
+	}
+	o, _ = (&i).env.Get("b")
+	if b := o.(float64); b != 7 {
+		t.Errorf("expected the nearest decorator to apply first, b = %v", b)
+	}
+	o, _ = (&i).env.Get("d")
+	if d := o.(float64); d != 20 {
+		t.Errorf("expected d = 20, instead d = %v", d)
+	}
+	o, _ = (&i).env.Get("c")
+	if n := o.(*LoxInstance).Fields["n"]; n != 1.0 {
+		t.Errorf("expected the memoized method to run once per instance, ran %v times", n)
+	}
+}
+
+func TestMethodDecoratorsApplyOnce(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var declared = 0;
+	var calls = 0;
+	fun count(fn) {
+		declared = declared + 1;
+		fun g(...args) { calls = calls + 1; return fn(...args); }
+		return g;
+	}
+	class V {
+		init(x) { this.x = x; }
+		@count
+		toString() { return "V"; }
+		@count
+		__add__(o) { return V(this.x + o.x); }
+		@count
+		iterator() { return [this.x]; }
+	}
+	var before = declared;
+	var v = V(1) + V(2);
+	var sum = 0;
+	for (var x in v) sum = sum + x;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	get := func(name string) interface{} {
+		o, _ := (&i).env.Get(name)
+		return o
+	}
+	if before := get("before"); before != 3.0 {
+		t.Errorf("expected the decorators to run when the class is declared, ran %v times", before)
+	}
+	if s := (&i).Stringify(get("v")); s != "V" {
+		t.Errorf("expected v to print as V, got %v", s)
+	}
+	if sum := get("sum"); sum != 3.0 {
+		t.Errorf("expected sum = 3, instead sum = %v", sum)
+	}
+	if declared := get("declared"); declared != 3.0 {
+		t.Errorf("expected the decorators to run once, ran %v times", declared)
+	}
+	if calls := get("calls"); calls != 3.0 {
+		t.Errorf("expected toString, __add__ and iterator to go through their decorators, calls = %v", calls)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var log = "";
+	fun note(m) { log = log + m; }
+	fun f(x) {
+		defer note("a");
+		defer note(x);
+		x = "changed";
+		{ defer note("c"); }
+		return "r";
+	}
+	var a = f("b");
+	fun fails() { defer note("d"); var n = nil; n.field; }
+	fails();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected fails() to raise an error")
+		}
+		o, _ := (&i).env.Get("a")
+		if a := o.(string); a != "r" {
+			t.Errorf("expected a = r, instead a = %v", a)
+		}
+		// "cba" from f, last in first out with arguments evaluated early, then "d" despite the error
+		o, _ = (&i).env.Get("log")
+		if log := o.(string); log != "cbad" {
+			t.Errorf("expected log = cbad, instead log = %v", log)
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestDoWhileAndContinue(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var a = 0;
+	do { a = a + 1; } while (false);
+	var i = 0;
+	var b = 0;
+	do {
+		i = i + 1;
+		if (i == 3) continue;
+		if (i == 6) break;
+		b = b + i;
+	} while (i < 10);
+	var c = 0;
+	for (var j = 0; j < 5; j = j + 1) { if (j == 2) continue; c = c + j; }
+	var d = 0;
+	for (x in 0..4) { if (x == 1) continue; d = d + x; }
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	expectations := map[string]float64{"a": 1, "b": 1 + 2 + 4 + 5, "c": 0 + 1 + 3 + 4, "d": 0 + 2 + 3 + 4}
+	for name, expected := range expectations {
+		o, _ := (&i).env.Get(name)
+		if v := o.(float64); v != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, v)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var xs = [1, 2];
+	assert xs[0] == 1;
+	fun f(x) { return x; }
+	assert f(xs[1]) > 5, "too small";
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+
+	disabled := MakeInterpreter()
+	disabled.DisableAssertions = true
+	(&disabled).Interpret(stmts)
+
+	i := MakeInterpreter()
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok {
+			t.Fatalf("expected the second assert to fail, got %v", r)
+		}
+		expected := "line 5: assertion failed: f(xs[1]) > 5: too small"
+		if err.Error() != expected {
+			t.Errorf("expected %q, got %q", expected, err.Error())
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestTailCalls(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun count(n, acc) { if (n == 0) return acc; return count(n - 1, acc + 1); }
+	fun isEven(n) { if (n == 0) return true; return isOdd(n - 1); }
+	fun isOdd(n) { if (n == 0) return false; return isEven(n - 1); }
+	var a = count(100000, 0);
+	var b = isEven(10001);
+	var log = "";
+	fun note(m) { log = log + m; return m; }
+	fun f() { defer note("a"); return note("b"); }
+	var c = f();
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	if o, _ := (&i).env.Get("a"); o.(float64) != 100000 {
+		t.Errorf("expected a = 100000, instead a = %v", o)
+	}
+	if o, _ := (&i).env.Get("b"); o.(bool) {
+		t.Errorf("expected b = false, instead b = %v", o)
+	}
+	// a function's deferred calls still run after the call it returns
+	if o, _ := (&i).env.Get("log"); o.(string) != "ba" {
+		t.Errorf("expected log = ba, instead log = %v", o)
+	}
+	if o, _ := (&i).env.Get("c"); o.(string) != "b" {
+		t.Errorf("expected c = b, instead c = %v", o)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var name = gensym("i");
+	var value = quote(1 + 2);
+	var code = quote { var $name = $value; print $name; };
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	o, _ := (&i).env.Get("name")
+	name := o.(*LoxSymbol).Name
+	o, _ = (&i).env.Get("code")
+	code := o.(*LoxCode)
+	decl, ok := code.Statements[0].(*expr.Var)
+	if !ok || decl.Name.Lexeme != name {
+		t.Fatalf("expected a declaration of %v, got %v", name, code.Statements[0])
+	}
+	if _, ok := decl.Initializer.(*expr.Binary); !ok {
+		t.Errorf("expected $value to be replaced by 1 + 2, got %v", decl.Initializer)
+	}
+	printed := code.Statements[1].(*expr.Print).Expression.(*expr.Variable)
+	if printed.Name.Lexeme != name {
+		t.Errorf("expected print %v, got print %v", name, printed.Name.Lexeme)
+	}
+}
+
+func TestContracts(t *testing.T) {
+	tests := map[string]string{
+		`fun half(x) requires x > 0 { return x / 2; } half(-2);`:                        "line 1: precondition of half failed: requires x > 0",
+		`fun f() ensures result != nil { return nil; } f();`:                            "line 1: postcondition of f failed: ensures result != nil",
+		`fun g(n) ensures result == 0 { if (n == 0) return 1; return g(n - 1); } g(3);`: "line 1: postcondition of g failed: ensures result == 0",
+	}
+	for src, expected := range tests {
+		scanner := scanner.MakeScanner(src)
+		parser := parser.Parser{Tokens: scanner.ScanTokens()}
+		stmts, _ := parser.Parse()
+
+		disabled := MakeInterpreter()
+		disabled.DisableContracts = true
+		(&disabled).Interpret(stmts)
+
+		func() {
+			defer func() {
+				err, ok := recover().(ContractError)
+				if !ok {
+					t.Errorf("expected a ContractError from %v", src)
+				} else if err.Error() != expected {
+					t.Errorf("expected %q, got %q", expected, err.Error())
+				}
+			}()
+			i := MakeInterpreter()
+			(&i).Interpret(stmts)
+		}()
+	}
+}
+
+func TestSet(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	record Point(x, y);
+	var points = Set(Point(1, 2), Point(1, 2), Point(3, 4));
+	var size = points.size();
+	var hasPoint = points.has(Point(3, 4));
+	var removed = points.remove(Point(1, 2));
+	var a = Set(1, 2, 3);
+	var b = Set(...[2, 3, 4]);
+	var union = a.union(b);
+	var intersection = a.intersection(b);
+	var difference = a.difference(b);
+	var equal = a == Set(3, 2, 1);
+	var sum = 0;
+	for (x in a) sum = sum + x;
+	var isSet = a is Set;
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	expectations := map[string]interface{}{
+		"size": 2.0, "hasPoint": true, "removed": true, "equal": true, "sum": 6.0, "isSet": true,
+	}
+	for name, expected := range expectations {
+		if o, _ := (&i).env.Get(name); o != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, o)
+		}
+	}
+	sets := map[string]string{
+		"points": "Set(Point(x: 3, y: 4))", "union": "Set(1, 2, 3, 4)", "intersection": "Set(2, 3)", "difference": "Set(1)",
+	}
+	for name, expected := range sets {
+		o, _ := (&i).env.Get(name)
+		if s := (&i).Stringify(o); s != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, s)
+		}
+	}
+}
+
+func TestSetHashing(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	record P(s);
+	var nested = Set(freeze(Set(1, 2)), freeze(Set(2, 1))).size();
+	var inRecord = {P(freeze(Set(1))): "found"}[P(Set(1))];
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	expectations := map[string]interface{}{"nested": 1.0, "inRecord": "found"}
+	for name, expected := range expectations {
+		if o, _ := (&i).env.Get(name); o != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, o)
+		}
+	}
+}
+
+func TestUnhashableKeys(t *testing.T) {
+	for _, src := range []string{
+		`Set(Set(1));`,
+		`record P(s); var m = {P(Set(1)): 1};`,
+		`class E { __eq__(o) { return true; } } Set(E());`,
+		`class E { __eq__(o) { return true; } } var m = {}; m[E()];`,
+	} {
+		scanner := scanner.MakeScanner(src)
+		parser := parser.Parser{Tokens: scanner.ScanTokens()}
+		stmts, err := parser.Parse()
+		if err != nil {
+			t.Errorf("didn't parse, %v", err)
+		}
+		i := MakeInterpreter()
+
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected %q to fail", src)
+				}
+			}()
+			(&i).Interpret(stmts)
+		}()
+	}
+}
+
+func TestFreezeSet(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	class Holder { init() { this.tags = Set(1); } }
+	var h = freeze(Holder());
+	h.tags.add(2);
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected adding to a set in a frozen instance to fail")
+		}
+	}()
+	(&i).Interpret(stmts)
+}
+
+func TestPersistentCollections(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	var v1 = PersistentList(1, 2, 3);
+	var v2 = v1.append(4).set(0, "one");
+	var first = v1[0];
+	var updated = v2.get(0);
+	var size = v2.size();
+	var popped = v1.pop().size();
+	var m1 = PersistentMap({"debug": false});
+	var m2 = m1.set("debug", true).set("level", 3);
+	var debug = m1["debug"];
+	var level = m2.get("level");
+	var removed = m2.remove("debug").has("debug");
+	var equal = v1 == PersistentList(1, 2, 3);
+	var sum = 0;
+	for (x in v1) sum = sum + x;
+	var listKeys = Set(PersistentList(1, 2), PersistentList(1, 2)).size();
+	var mapKey = {m2: "found"}[PersistentMap({"level": 3, "debug": true})];
+	var nestedKey = PersistentMap().set(m1, 1).get(PersistentMap({"debug": false}));
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	(&i).Interpret(stmts)
+	expectations := map[string]interface{}{
+		"first": 1.0, "updated": "one", "size": 4.0, "popped": 2.0, "debug": false, "level": 3.0,
+		"removed": false, "equal": true, "sum": 6.0, "listKeys": 1.0, "mapKey": "found", "nestedKey": 1.0,
+	}
+	for name, expected := range expectations {
+		if o, _ := (&i).env.Get(name); o != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, o)
+		}
+	}
+}
+
+func TestFunctionAsMapKey(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	fun f() {}
+	var m = {f: 1};
+	`)
+	parser := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := parser.Parse()
+	if err != nil {
+		t.Errorf("didn't parse, %v", err)
+	}
+	i := MakeInterpreter()
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok {
+			t.Fatalf("expected a function map key to fail")
+		}
+		if !strings.Contains(err.Error(), "a Function cannot be used as a map key") {
+			t.Errorf("unexpected error %q", err.Error())
+		}
+	}()
+	(&i).Interpret(stmts)
+}
@@ -0,0 +1,88 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/weiser/lox/token"
+)
+
+// Iterator is how for-in loops and spreads walk a value. lists, maps (their keys),
+// strings (their characters), ranges and generators are iterable, as is any instance with
+// `hasNext()`/`next()` methods or an `iterator()` method returning something iterable
+type Iterator interface {
+	HasNext() bool
+	Next() (interface{}, bool)
+}
+
+type sliceIterator struct {
+	values []interface{}
+	pos    int
+}
+
+func (si *sliceIterator) HasNext() bool {
+	return si.pos < len(si.values)
+}
+
+func (si *sliceIterator) Next() (interface{}, bool) {
+	if !si.HasNext() {
+		return nil, false
+	}
+	si.pos += 1
+	return si.values[si.pos-1], true
+}
+
+// instanceIterator drives a lox object implementing `hasNext()` and `next()`
+type instanceIterator struct {
+	interpreter *Interpreter
+	hasNext     LoxCallable
+	next        LoxCallable
+}
+
+func (ii *instanceIterator) HasNext() bool {
+	v, _ := toTruthy(ii.hasNext.Call(ii.interpreter, []interface{}{}))
+	return v
+}
+
+func (ii *instanceIterator) Next() (interface{}, bool) {
+	if !ii.HasNext() {
+		return nil, false
+	}
+	return ii.next.Call(ii.interpreter, []interface{}{}), true
+}
+
+func (i *Interpreter) iterate(value interface{}, tok token.Token) Iterator {
+	switch v := value.(type) {
+	case Iterator:
+		return v
+	case LoxRange:
+		return v.Iterator()
+	case *LoxList:
+		// iterate over a snapshot, so appending inside the loop can't make it run forever
+		return &sliceIterator{values: append([]interface{}{}, v.Elements...)}
+	case *LoxMap:
+		return &sliceIterator{values: append([]interface{}{}, v.Keys...)}
+	case *LoxSet:
+		return &sliceIterator{values: v.Elements()}
+	case *LoxPersistentList:
+		return &sliceIterator{values: v.Elements()}
+	case *LoxPersistentMap:
+		return &sliceIterator{values: v.Keys()}
+	case string:
+		chars := make([]interface{}, 0, len(v))
+		for _, c := range v {
+			chars = append(chars, string(c))
+		}
+		return &sliceIterator{values: chars}
+	case *LoxInstance:
+		if method, ok := v.method("iterator"); ok {
+			return i.iterate(method.Call(i, []interface{}{}), tok)
+		}
+		hasNext, hok := v.method("hasNext")
+		next, nok := v.method("next")
+		if hok && nok {
+			return &instanceIterator{interpreter: i, hasNext: hasNext, next: next}
+		}
+	}
+	panic(errors.New(fmt.Sprintf("%v: a %v is not iterable", tok, typeName(value))))
+}
@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/weiser/lox/token"
+)
+
+// operatorMethods are the special methods a class can define to overload a binary operator.
+// `a + b` calls `a.__add__(b)` when `a` is an instance of such a class
+var operatorMethods = map[token.TType]string{
+	token.PLUS:          "__add__",
+	token.MINUS:         "__sub__",
+	token.STAR:          "__mul__",
+	token.SLASH:         "__div__",
+	token.LESS:          "__lt__",
+	token.LESS_EQUAL:    "__le__",
+	token.GREATER:       "__gt__",
+	token.GREATER_EQUAL: "__ge__",
+}
+
+// reflectedMethods are tried on the right operand when the left one isn't an instance, so
+// `2 * v` calls `v.__rmul__(2)` and `1 < v` calls `v.__gt__(1)`
+var reflectedMethods = map[token.TType]string{
+	token.PLUS:          "__radd__",
+	token.MINUS:         "__rsub__",
+	token.STAR:          "__rmul__",
+	token.SLASH:         "__rdiv__",
+	token.LESS:          "__gt__",
+	token.LESS_EQUAL:    "__ge__",
+	token.GREATER:       "__lt__",
+	token.GREATER_EQUAL: "__le__",
+}
+
+// callOperator runs the left operand's method for operator, if it defines one.
+// `==` and `!=` go through isEqual so that they also use `__eq__`
+func (i *Interpreter) callOperator(left *LoxInstance, operator token.Token, right interface{}) (interface{}, bool) {
+	name, ok := operatorMethods[operator.TokenType]
+	if !ok {
+		return nil, false
+	}
+	method, ok := left.method(name)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: %v does not define %v", operator, left.Klass.Name, name)))
+	}
+	if !arityMatches(method, 1) {
+		panic(errors.New(fmt.Sprintf("%v: %v.%v must take 1 argument", operator, left.Klass.Name, name)))
+	}
+	return method.Call(i, []interface{}{right}), true
+}
+
+// callReflectedOperator runs the right operand's reflected method for operator, if it defines one
+func (i *Interpreter) callReflectedOperator(right *LoxInstance, operator token.Token, left interface{}) (interface{}, bool) {
+	name, ok := reflectedMethods[operator.TokenType]
+	if !ok {
+		return nil, false
+	}
+	method, ok := right.method(name)
+	if !ok {
+		return nil, false
+	}
+	if !arityMatches(method, 1) {
+		panic(errors.New(fmt.Sprintf("%v: %v.%v must take 1 argument", operator, right.Klass.Name, name)))
+	}
+	return method.Call(i, []interface{}{left}), true
+}
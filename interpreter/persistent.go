@@ -0,0 +1,218 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/persistent"
+	"github.com/weiser/lox/token"
+)
+
+// LoxPersistentList is the runtime value of `PersistentList(1, 2, 3)`. it can't be changed:
+// `set`, `append` and `pop` return a new list, which shares most of its structure with the old one
+type LoxPersistentList struct {
+	vector *persistent.Vector
+}
+
+// LoxPersistentMap is the runtime value of `PersistentMap({"a": 1})`. like LoxPersistentList,
+// `set` and `remove` return a new map. keys follow the same rules as LoxMap keys
+type LoxPersistentMap struct {
+	entries *persistent.Map
+}
+
+// persistentEntry keeps the key as it was given, since the map is keyed by its hashKey
+type persistentEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func (pl *LoxPersistentList) Elements() []interface{} {
+	return pl.vector.Elements()
+}
+
+func (pl *LoxPersistentList) index(key interface{}, bracket token.Token) interface{} {
+	v, _ := pl.vector.Get(toIndex(key, pl.vector.Len(), bracket))
+	return v
+}
+
+func (pl *LoxPersistentList) String() string {
+	elements := make([]string, 0, pl.vector.Len())
+	for _, e := range pl.Elements() {
+		elements = append(elements, fmt.Sprintf("%v", e))
+	}
+	return "PersistentList(" + strings.Join(elements, ", ") + ")"
+}
+
+func (pl *LoxPersistentList) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "get":
+		return NativeFunction{Name: "get", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return pl.index(arguments[0], name)
+		}}
+	case "set":
+		return NativeFunction{Name: "set", NumArgs: 2, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			ind := toIndex(arguments[0], pl.vector.Len(), name)
+			return &LoxPersistentList{vector: pl.vector.Set(ind, arguments[1])}
+		}}
+	case "append":
+		return NativeFunction{Name: "append", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return &LoxPersistentList{vector: pl.vector.Append(arguments[0])}
+		}}
+	case "pop":
+		return NativeFunction{Name: "pop", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			if pl.vector.Len() == 0 {
+				panic(errors.New(fmt.Sprintf("%v: cannot pop an empty list", name)))
+			}
+			return &LoxPersistentList{vector: pl.vector.Pop()}
+		}}
+	case "size":
+		return NativeFunction{Name: "size", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return float64(pl.vector.Len())
+		}}
+	case "toList":
+		return NativeFunction{Name: "toList", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return &LoxList{Elements: pl.Elements()}
+		}}
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+func (pm *LoxPersistentMap) lookup(key interface{}) (interface{}, bool) {
+	if !isHashable(key) {
+		return nil, false
+	}
+	e, ok := pm.entries.Get(hashKey(key))
+	if !ok {
+		return nil, false
+	}
+	return e.(persistentEntry).value, true
+}
+
+func (pm *LoxPersistentMap) set(key interface{}, value interface{}, tok token.Token) *LoxPersistentMap {
+	if !isHashable(key) {
+		panic(errors.New(fmt.Sprintf("%v: a %v cannot be used as a map key", tok, typeName(key))))
+	}
+	if hasMutableSet(key) {
+		panic(errors.New(fmt.Sprintf("%v: a Set must be frozen before it's used as a map key", tok)))
+	}
+	return &LoxPersistentMap{entries: pm.entries.Set(hashKey(key), persistentEntry{key: key, value: value})}
+}
+
+// Keys returns the keys in an order that depends on their hashes, not on when they were set
+func (pm *LoxPersistentMap) Keys() []interface{} {
+	keys := make([]interface{}, 0, pm.entries.Len())
+	pm.entries.Each(func(_ interface{}, e interface{}) {
+		keys = append(keys, e.(persistentEntry).key)
+	})
+	return keys
+}
+
+func (pm *LoxPersistentMap) String() string {
+	entries := make([]string, 0, pm.entries.Len())
+	for _, k := range pm.Keys() {
+		v, _ := pm.lookup(k)
+		entries = append(entries, fmt.Sprintf("%v: %v", k, v))
+	}
+	return "PersistentMap({" + strings.Join(entries, ", ") + "})"
+}
+
+func (pm *LoxPersistentMap) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "get":
+		return NativeFunction{Name: "get", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			// missing keys are nil, as with maps
+			v, _ := pm.lookup(arguments[0])
+			return v
+		}}
+	case "has":
+		return NativeFunction{Name: "has", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			_, ok := pm.lookup(arguments[0])
+			return ok
+		}}
+	case "set":
+		return NativeFunction{Name: "set", NumArgs: 2, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return pm.set(arguments[0], arguments[1], name)
+		}}
+	case "remove":
+		return NativeFunction{Name: "remove", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			if !isHashable(arguments[0]) {
+				return pm
+			}
+			return &LoxPersistentMap{entries: pm.entries.Delete(hashKey(arguments[0]))}
+		}}
+	case "size":
+		return NativeFunction{Name: "size", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return float64(pm.entries.Len())
+		}}
+	case "keys":
+		return NativeFunction{Name: "keys", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return &LoxList{Elements: pm.Keys()}
+		}}
+	case "toMap":
+		return NativeFunction{Name: "toMap", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			m := MakeLoxMap()
+			for _, k := range pm.Keys() {
+				v, _ := pm.lookup(k)
+				m.Set(k, v)
+			}
+			return m
+		}}
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+// persistent collections can't change, so they're equal when their contents are
+func (i *Interpreter) persistentEqual(l interface{}, r interface{}) (bool, bool) {
+	switch lv := l.(type) {
+	case *LoxPersistentList:
+		rv, ok := r.(*LoxPersistentList)
+		if !ok || lv.vector.Len() != rv.vector.Len() {
+			return false, true
+		}
+		re := rv.Elements()
+		for ind, e := range lv.Elements() {
+			if !i.isEqual(e, re[ind]) {
+				return false, true
+			}
+		}
+		return true, true
+	case *LoxPersistentMap:
+		rv, ok := r.(*LoxPersistentMap)
+		if !ok || lv.entries.Len() != rv.entries.Len() {
+			return false, true
+		}
+		for _, k := range lv.Keys() {
+			lvalue, _ := lv.lookup(k)
+			rvalue, ok := rv.lookup(k)
+			if !ok || !i.isEqual(lvalue, rvalue) {
+				return false, true
+			}
+		}
+		return true, true
+	}
+	return false, false
+}
+
+func definePersistentNatives(env environment.Environment) {
+	env.Define("PersistentList", NativeFunction{Name: "PersistentList", NumArgs: 0, Varargs: true, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+		return &LoxPersistentList{vector: persistent.MakeVector(arguments)}
+	}})
+	// PersistentMap() is empty, PersistentMap(map) copies a map's entries
+	env.Define("PersistentMap", NativeFunction{Name: "PersistentMap", NumArgs: 0, Varargs: true, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+		pm := &LoxPersistentMap{entries: persistent.EmptyMap()}
+		if len(arguments) == 0 {
+			return pm
+		}
+		m, ok := arguments[0].(*LoxMap)
+		if !ok || len(arguments) > 1 {
+			panic(errors.New("PersistentMap: expected nothing or a Map"))
+		}
+		for _, k := range m.Keys {
+			v, _ := m.Get(k)
+			pm = pm.set(k, v, token.Token{})
+		}
+		return pm
+	}})
+}
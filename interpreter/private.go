@@ -0,0 +1,26 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// members named `#name` are private to the class declaring them
+func isPrivate(name string) bool {
+	return strings.HasPrefix(name, "#")
+}
+
+// the resolver also checks that `this.#name` is inside the declaring class; here we can only
+// check that private members are reached through `this`, for code that was never resolved
+func checkPrivateAccess(object expr.ExprInterface, name token.Token) {
+	if !isPrivate(name.Lexeme) {
+		return
+	}
+	if _, ok := object.(*expr.This); !ok {
+		panic(errors.New(fmt.Sprintf("%v: private member '%v' can only be accessed through 'this'", name, name.Lexeme)))
+	}
+}
@@ -0,0 +1,210 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// LoxCode is a piece of the AST, made by `quote` or passed to a macro as an argument.
+// it holds either statements or an expression
+type LoxCode struct {
+	Statements []expr.StmtInterface
+	Expression expr.ExprInterface
+}
+
+func (c *LoxCode) String() string {
+	if c.Expression != nil {
+		return "<code expression>"
+	}
+	return fmt.Sprintf("<code %v statements>", len(c.Statements))
+}
+
+// LoxSymbol is a name made by `gensym`. it can't collide with a name written in the program, so
+// macros use symbols for the variables they declare, which keeps them from capturing the caller's
+type LoxSymbol struct {
+	Name string
+}
+
+func (s *LoxSymbol) String() string {
+	return s.Name
+}
+
+var gensymCount = 0
+
+func defineMacroNatives(env environment.Environment) {
+	env.Define("gensym", NativeFunction{Name: "gensym", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+		prefix, ok := arguments[0].(string)
+		if !ok {
+			panic(errors.New(fmt.Sprintf("gensym: expected a String, got %v", typeName(arguments[0]))))
+		}
+		gensymCount += 1
+		// '`' can't appear in an identifier, so no name in the program matches this one
+		return &LoxSymbol{Name: fmt.Sprintf("%v`%v", prefix, gensymCount)}
+	}})
+}
+
+func (i *Interpreter) VisitQuote(exp *expr.Quote) interface{} {
+	u := unquoter{i: i, keyword: exp.Keyword}
+	if exp.Expression != nil {
+		return &LoxCode{Expression: u.expression(exp.Expression)}
+	}
+	return &LoxCode{Statements: u.statements(exp.Statements)}
+}
+
+// macros are defined while parsing, see parser.Macros
+func (i *Interpreter) VisitMacro(stmt *expr.Macro) interface{} {
+	return nil
+}
+
+// unquoter copies a quoted template, replacing each `$name` with the value of name. every
+// expansion gets its own copy of the nodes, since the resolver keys its results by node.
+// a nil interpreter copies without replacing anything
+type unquoter struct {
+	i       *Interpreter
+	keyword token.Token
+}
+
+func isUnquote(name token.Token) bool {
+	return name.TokenType == token.IDENTIFIER && strings.HasPrefix(name.Lexeme, "$")
+}
+
+func (u unquoter) lookup(name token.Token) interface{} {
+	value, err := u.i.env.Get(name.Lexeme[1:])
+	if err != nil {
+		panic(errors.New(fmt.Sprintf("%v: cannot unquote '%v', %v", u.keyword, name.Lexeme, err)))
+	}
+	return value
+}
+
+func (u unquoter) expression(exp expr.ExprInterface) expr.ExprInterface {
+	return u.copy(reflect.ValueOf(&exp).Elem()).Interface().(expr.ExprInterface)
+}
+
+// statements splices the statements of code unquoted in statement position, e.g. `$body;`
+func (u unquoter) statements(stmts []expr.StmtInterface) []expr.StmtInterface {
+	copied := make([]expr.StmtInterface, 0, len(stmts))
+	for _, stmt := range stmts {
+		if code := u.unquotedStatements(stmt); code != nil {
+			copied = append(copied, unquoter{}.statements(code.Statements)...)
+			continue
+		}
+		copied = append(copied, u.copy(reflect.ValueOf(&stmt).Elem()).Interface().(expr.StmtInterface))
+	}
+	return copied
+}
+
+func (u unquoter) unquotedStatements(stmt expr.StmtInterface) *LoxCode {
+	if u.i == nil {
+		return nil
+	}
+	es, ok := stmt.(*expr.Expression)
+	if !ok {
+		return nil
+	}
+	v, ok := es.Expression.(*expr.Variable)
+	if !ok || !isUnquote(v.Name) {
+		return nil
+	}
+	if code, ok := u.lookup(v.Name).(*LoxCode); ok && code.Expression == nil {
+		return code
+	}
+	return nil
+}
+
+// copy walks the AST with reflection rather than a visitor, so new node types are copied
+// without having to be listed here
+func (u unquoter) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		switch node := v.Interface().(type) {
+		case *expr.Variable:
+			if u.i != nil && isUnquote(node.Name) {
+				return reflect.ValueOf(u.unquoteExpression(node.Name))
+			}
+		case *expr.Expression:
+			// a statement in a position that holds one, e.g. an if's branch
+			if code := u.unquotedStatements(node); code != nil {
+				stmts := unquoter{}.statements(code.Statements)
+				if len(stmts) == 1 {
+					return reflect.ValueOf(stmts[0])
+				}
+				return reflect.ValueOf(&expr.Block{Statements: stmts})
+			}
+		}
+		return u.copy(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return v
+		}
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(u.copy(v.Elem()))
+		return copied
+	case reflect.Struct:
+		if tok, ok := v.Interface().(token.Token); ok {
+			return reflect.ValueOf(u.unquoteName(tok))
+		}
+		copied := reflect.New(v.Type()).Elem()
+		for f := 0; f < v.NumField(); f++ {
+			copied.Field(f).Set(u.copy(v.Field(f)))
+		}
+		return copied
+	case reflect.Slice:
+		if stmts, ok := v.Interface().([]expr.StmtInterface); ok {
+			return reflect.ValueOf(u.statements(stmts))
+		}
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for ind := 0; ind < v.Len(); ind++ {
+			copied.Index(ind).Set(u.copy(v.Index(ind)))
+		}
+		return copied
+	}
+	return v
+}
+
+// unquoteExpression replaces `$name` in expression position
+func (u unquoter) unquoteExpression(name token.Token) expr.ExprInterface {
+	switch value := u.lookup(name).(type) {
+	case *LoxCode:
+		if value.Expression == nil {
+			panic(errors.New(fmt.Sprintf("%v: cannot use the statements in '%v' as an expression", u.keyword, name.Lexeme)))
+		}
+		return unquoter{}.expression(value.Expression)
+	case *LoxSymbol:
+		return &expr.Variable{Name: u.unquoteName(name)}
+	case nil, float64, string, bool:
+		return &expr.Literal{Value: value}
+	default:
+		panic(errors.New(fmt.Sprintf("%v: cannot unquote a %v into code", u.keyword, typeName(value))))
+	}
+}
+
+// unquoteName replaces `$name` where the template needs a name, e.g. `var $i = 0;`. the value
+// can be a symbol or an identifier passed to the macro
+func (u unquoter) unquoteName(name token.Token) token.Token {
+	if u.i == nil || !isUnquote(name) {
+		return name
+	}
+	switch value := u.lookup(name).(type) {
+	case *LoxSymbol:
+		name.Lexeme = value.Name
+		return name
+	case *LoxCode:
+		if v, ok := value.Expression.(*expr.Variable); ok {
+			name.Lexeme = v.Name.Lexeme
+			return name
+		}
+	}
+	panic(errors.New(fmt.Sprintf("%v: '%v' must be a symbol or an identifier to be used as a name", u.keyword, name.Lexeme)))
+}
@@ -0,0 +1,112 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+// LoxRange is the lazy value of `start..end` (inclusive) or `start..<end` (exclusive).
+// it only stores its bounds, so `0..1000000` costs the same as `0..1`
+type LoxRange struct {
+	Start     float64
+	End       float64
+	Step      float64
+	Inclusive bool
+}
+
+func (lr LoxRange) inBounds(v float64) bool {
+	switch {
+	case lr.Step > 0 && lr.Inclusive:
+		return v >= lr.Start && v <= lr.End
+	case lr.Step > 0:
+		return v >= lr.Start && v < lr.End
+	case lr.Inclusive:
+		return v <= lr.Start && v >= lr.End
+	default:
+		return v <= lr.Start && v > lr.End
+	}
+}
+
+// Contains reports whether iterating the range would produce v
+func (lr LoxRange) Contains(v float64) bool {
+	steps := (v - lr.Start) / lr.Step
+	return lr.inBounds(v) && steps == float64(int(steps))
+}
+
+func (lr LoxRange) Iterator() Iterator {
+	return &rangeIterator{r: lr, next: lr.Start}
+}
+
+func (lr LoxRange) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "start":
+		return lr.Start
+	case "end":
+		return lr.End
+	case "step":
+		return NativeFunction{Name: "step", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			step, err := toFloat(arguments[0])
+			if err != nil || step == 0 {
+				panic(errors.New(fmt.Sprintf("%v: step must be a non-zero number, got %v", name, i.Stringify(arguments[0]))))
+			}
+			return LoxRange{Start: lr.Start, End: lr.End, Step: step, Inclusive: lr.Inclusive}
+		}}
+	case "contains":
+		return NativeFunction{Name: "contains", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			v, err := toFloat(arguments[0])
+			return err == nil && lr.Contains(v)
+		}}
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+func (lr LoxRange) String() string {
+	operator := "..<"
+	if lr.Inclusive {
+		operator = ".."
+	}
+	if lr.Step != 1 {
+		return fmt.Sprintf("%v%v%v step %v", lr.Start, operator, lr.End, lr.Step)
+	}
+	return fmt.Sprintf("%v%v%v", lr.Start, operator, lr.End)
+}
+
+type rangeIterator struct {
+	r    LoxRange
+	next float64
+}
+
+func (ri *rangeIterator) HasNext() bool {
+	return ri.r.inBounds(ri.next)
+}
+
+func (ri *rangeIterator) Next() (interface{}, bool) {
+	if !ri.HasNext() {
+		return nil, false
+	}
+	v := ri.next
+	ri.next += ri.r.Step
+	return v, true
+}
+
+func (i *Interpreter) VisitRange(exp *expr.Range) interface{} {
+	start, serr := toFloat(i.Evaluate(exp.Start))
+	end, eerr := toFloat(i.Evaluate(exp.End))
+	if serr != nil || eerr != nil {
+		panic(errors.New(fmt.Sprintf("%v: range bounds must be numbers", exp.Operator)))
+	}
+	return LoxRange{Start: start, End: end, Step: 1, Inclusive: exp.Operator.TokenType == token.DOT_DOT}
+}
+
+// slice picks the elements of a list or string at each index produced by the range
+func slice(r LoxRange, length int, bracket token.Token) []int {
+	indices := make([]int, 0)
+	iter := r.Iterator()
+	for v, ok := iter.Next(); ok; v, ok = iter.Next() {
+		indices = append(indices, toIndex(v, length, bracket))
+	}
+	return indices
+}
@@ -0,0 +1,242 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/expr"
+)
+
+// typeName names the kind of a value, using the same names as type annotations.
+// an instance's type is its class's name, and an enum member's type is its enum's name
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "Nil"
+	case float64, int64, int:
+		return "Number"
+	case string:
+		return "String"
+	case bool:
+		return "Bool"
+	case *LoxList:
+		return "List"
+	case *LoxMap:
+		return "Map"
+	case *LoxSet:
+		return "Set"
+	case *LoxPersistentList:
+		return "PersistentList"
+	case *LoxPersistentMap:
+		return "PersistentMap"
+	case LoxRange:
+		return "Range"
+	case *LoxGenerator:
+		return "Generator"
+	case *LoxClass:
+		return "Class"
+	case *LoxTrait:
+		return "Trait"
+	case *LoxEnum:
+		return "Enum"
+	case *LoxEnumValue:
+		return v.Enum.Name
+	case *LoxInstance:
+		return v.Klass.Name
+	case *LoxCode:
+		return "Code"
+	case *LoxSymbol:
+		return "Symbol"
+	case LoxCallable:
+		return "Function"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// builtinKinds are the names `is` accepts besides classes, traits and enums, e.g. `x is String`
+var builtinKinds = map[string]bool{
+	"Nil": true, "Number": true, "String": true, "Bool": true, "List": true, "Map": true, "Set": true, "Range": true,
+	"Generator": true, "Class": true, "Trait": true, "Enum": true, "Function": true, "Code": true, "Symbol": true,
+	"PersistentList": true, "PersistentMap": true,
+}
+
+// isA reports whether value is an instance of a class (or of a class using a trait), or a member of an enum
+func isA(value interface{}, target interface{}) (bool, bool) {
+	switch t := target.(type) {
+	case *LoxClass:
+		instance, ok := value.(*LoxInstance)
+		return ok && instance.Klass == t, true
+	case *LoxTrait:
+		instance, ok := value.(*LoxInstance)
+		if !ok {
+			return false, true
+		}
+		for _, trait := range instance.Klass.Traits {
+			if trait == t {
+				return true, true
+			}
+		}
+		return false, true
+	case *LoxEnum:
+		member, ok := value.(*LoxEnumValue)
+		return ok && member.Enum == t, true
+	}
+	return false, false
+}
+
+// Freeze makes an instance or set, and every instance and set reachable from it, immutable
+func Freeze(value interface{}) {
+	switch v := value.(type) {
+	case *LoxInstance:
+		if v.Frozen {
+			// already frozen, or we're in a cycle
+			return
+		}
+		v.Frozen = true
+		for _, field := range v.Fields {
+			Freeze(field)
+		}
+	case *LoxList:
+		for _, element := range v.Elements {
+			Freeze(element)
+		}
+	case *LoxMap:
+		for _, k := range v.Keys {
+			value, _ := v.Get(k)
+			Freeze(k)
+			Freeze(value)
+		}
+	case *LoxSet:
+		if v.Frozen {
+			return
+		}
+		v.Frozen = true
+		for _, element := range v.Elements() {
+			Freeze(element)
+		}
+	}
+}
+
+func toInstance(fxn string, value interface{}) *LoxInstance {
+	instance, ok := value.(*LoxInstance)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: expected an instance, got %v", fxn, typeName(value))))
+	}
+	return instance
+}
+
+func toFieldName(fxn string, value interface{}) string {
+	name, ok := value.(string)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: field name must be a String, got %v", fxn, typeName(value))))
+	}
+	if isPrivate(name) {
+		panic(errors.New(fmt.Sprintf("%v: cannot access private field '%v'", fxn, name)))
+	}
+	return name
+}
+
+// toSortedList makes the public names of fields or methods into a list. go maps are unordered,
+// so we sort them to make the output of `fields` and `methods` deterministic
+func toSortedList(names []string) *LoxList {
+	sort.Strings(names)
+	elements := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		if !isPrivate(name) {
+			elements = append(elements, name)
+		}
+	}
+	return &LoxList{Elements: elements}
+}
+
+// defineReflectionNatives adds the natives that let lox code inspect objects at runtime,
+// e.g. to write a generic serializer
+func defineReflectionNatives(env environment.Environment) {
+	natives := []NativeFunction{
+		{Name: "type", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return typeName(arguments[0])
+		}},
+		{Name: "isInstance", NumArgs: 2, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			klass, ok := arguments[1].(*LoxClass)
+			if !ok {
+				panic(errors.New(fmt.Sprintf("isInstance: expected a class, got %v", typeName(arguments[1]))))
+			}
+			instance, ok := arguments[0].(*LoxInstance)
+			return ok && instance.Klass == klass
+		}},
+		{Name: "className", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			if klass, ok := arguments[0].(*LoxClass); ok {
+				return klass.Name
+			}
+			return toInstance("className", arguments[0]).Klass.Name
+		}},
+		{Name: "fields", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			names := make([]string, 0)
+			for name := range toInstance("fields", arguments[0]).Fields {
+				names = append(names, name)
+			}
+			return toSortedList(names)
+		}},
+		{Name: "methods", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			klass, ok := arguments[0].(*LoxClass)
+			if !ok {
+				klass = toInstance("methods", arguments[0]).Klass
+			}
+			names := make([]string, 0, len(klass.Methods))
+			for name := range klass.Methods {
+				names = append(names, name)
+			}
+			return toSortedList(names)
+		}},
+		{Name: "hasField", NumArgs: 2, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			_, ok := toInstance("hasField", arguments[0]).Fields[toFieldName("hasField", arguments[1])]
+			return ok
+		}},
+		{Name: "getField", NumArgs: 2, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			instance := toInstance("getField", arguments[0])
+			name := toFieldName("getField", arguments[1])
+			v, ok := instance.Fields[name]
+			if !ok {
+				panic(errors.New(fmt.Sprintf("getField: %v has no field '%v'", instance, name)))
+			}
+			return v
+		}},
+		{Name: "freeze", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			Freeze(arguments[0])
+			return arguments[0]
+		}},
+		{Name: "setField", NumArgs: 3, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			if err := toInstance("setField", arguments[0]).setField(toFieldName("setField", arguments[1]), arguments[2]); err != nil {
+				panic(errors.New(fmt.Sprintf("setField: %v", err)))
+			}
+			return arguments[2]
+		}},
+	}
+	for _, native := range natives {
+		env.Define(native.Name, native)
+	}
+}
+
+func (i *Interpreter) VisitIs(exp *expr.Is) interface{} {
+	value := i.Evaluate(exp.Object)
+	name := exp.Target.(*expr.Variable).Name
+	target, err := i.LookupVariable(name, exp.Target)
+	if err != nil {
+		// a user defined `String` class shadows the builtin kind
+		if builtinKinds[name.Lexeme] {
+			return typeName(value) == name.Lexeme
+		}
+		panic(err)
+	}
+	result, ok := isA(value, target)
+	if !ok && builtinKinds[name.Lexeme] {
+		// e.g. `Set`, which names both a kind and its constructor
+		return typeName(value) == name.Lexeme
+	}
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: '%v' is not a class, trait or enum", name, name.Lexeme)))
+	}
+	return result
+}
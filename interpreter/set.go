@@ -0,0 +1,160 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/weiser/lox/environment"
+	"github.com/weiser/lox/token"
+)
+
+// LoxSet is the runtime value of `Set(1, 2, ...rest)`. elements are stored as the keys of a
+// LoxMap, so they follow the same rules as map keys, e.g. records with equal fields are the
+// same element, and they iterate in insertion order. sets are hashed by their elements, so only
+// a frozen set can be a key or an element
+type LoxSet struct {
+	elements *LoxMap
+	// frozen sets (anything passed to `freeze`) can't be added to or removed from
+	Frozen bool
+}
+
+func MakeLoxSet(elements []interface{}) *LoxSet {
+	s := &LoxSet{elements: MakeLoxMap()}
+	for _, element := range elements {
+		s.Add(element)
+	}
+	return s
+}
+
+func (s *LoxSet) Add(element interface{}) {
+	if !isHashable(element) {
+		panic(errors.New(fmt.Sprintf("a %v cannot be a set element", typeName(element))))
+	}
+	s.elements.Set(element, true)
+}
+
+func (s *LoxSet) Has(element interface{}) bool {
+	if !isHashable(element) {
+		return false
+	}
+	_, ok := s.elements.Get(element)
+	return ok
+}
+
+func (s *LoxSet) Remove(element interface{}) bool {
+	if !s.Has(element) {
+		return false
+	}
+	s.elements.Delete(element)
+	return true
+}
+
+// Elements returns the elements in insertion order
+func (s *LoxSet) Elements() []interface{} {
+	return append([]interface{}{}, s.elements.Keys...)
+}
+
+func (s *LoxSet) Len() int {
+	return len(s.elements.Keys)
+}
+
+func (s *LoxSet) Union(other *LoxSet) *LoxSet {
+	return MakeLoxSet(append(s.Elements(), other.Elements()...))
+}
+
+func (s *LoxSet) Intersection(other *LoxSet) *LoxSet {
+	return s.filter(func(element interface{}) bool { return other.Has(element) })
+}
+
+func (s *LoxSet) Difference(other *LoxSet) *LoxSet {
+	return s.filter(func(element interface{}) bool { return !other.Has(element) })
+}
+
+func (s *LoxSet) filter(keep func(interface{}) bool) *LoxSet {
+	result := MakeLoxSet(nil)
+	for _, element := range s.elements.Keys {
+		if keep(element) {
+			result.Add(element)
+		}
+	}
+	return result
+}
+
+// sets are equal when they have the same elements, in any order
+func (s *LoxSet) equals(other *LoxSet) bool {
+	if s.Len() != other.Len() {
+		return false
+	}
+	for _, element := range s.elements.Keys {
+		if !other.Has(element) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LoxSet) String() string {
+	elements := make([]string, 0, s.Len())
+	for _, e := range s.elements.Keys {
+		elements = append(elements, fmt.Sprintf("%v", e))
+	}
+	return "Set(" + strings.Join(elements, ", ") + ")"
+}
+
+func (s *LoxSet) checkNotFrozen(name token.Token) {
+	if s.Frozen {
+		panic(errors.New(fmt.Sprintf("%v: cannot modify frozen %v", name, s)))
+	}
+}
+
+func toSet(fxn string, value interface{}) *LoxSet {
+	s, ok := value.(*LoxSet)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("%v: expected a Set, got %v", fxn, typeName(value))))
+	}
+	return s
+}
+
+func (s *LoxSet) Get(name token.Token) interface{} {
+	switch name.Lexeme {
+	case "add":
+		return NativeFunction{Name: "add", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			s.checkNotFrozen(name)
+			s.Add(arguments[0])
+			return nil
+		}}
+	case "remove":
+		return NativeFunction{Name: "remove", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			s.checkNotFrozen(name)
+			return s.Remove(arguments[0])
+		}}
+	case "has":
+		return NativeFunction{Name: "has", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return s.Has(arguments[0])
+		}}
+	case "size":
+		return NativeFunction{Name: "size", NumArgs: 0, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return float64(s.Len())
+		}}
+	case "union":
+		return NativeFunction{Name: "union", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return s.Union(toSet("union", arguments[0]))
+		}}
+	case "intersection":
+		return NativeFunction{Name: "intersection", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return s.Intersection(toSet("intersection", arguments[0]))
+		}}
+	case "difference":
+		return NativeFunction{Name: "difference", NumArgs: 1, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+			return s.Difference(toSet("difference", arguments[0]))
+		}}
+	}
+	panic(fmt.Sprintf("%v: undefined property '%v'", name, name.Lexeme))
+}
+
+func defineSetNatives(env environment.Environment) {
+	env.Define("Set", NativeFunction{Name: "Set", NumArgs: 0, Varargs: true, Fn: func(i *Interpreter, arguments []interface{}) interface{} {
+		return MakeLoxSet(arguments)
+	}})
+}
@@ -0,0 +1,84 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Stringify is how every lox value is shown to the user, by `print` and the REPL.
+// instances can customize it by defining `toString()` (or `__str__()`)
+func (i *Interpreter) Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		// whole numbers print without a decimal point or exponent, e.g. 1000000 rather than 1e+06
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case LoxFunction:
+		return v.String()
+	case *LoxClass:
+		return fmt.Sprintf("<class %v>", v.Name)
+	case *LoxInstance:
+		for _, name := range []string{"toString", "__str__"} {
+			if method, ok := v.method(name); ok && arityMatches(method, 0) {
+				return i.Stringify(method.Call(i, []interface{}{}))
+			}
+		}
+		if v.Klass.isRecord() {
+			return i.recordString(v)
+		}
+		return v.String()
+	case *LoxList:
+		elements := make([]string, 0, len(v.Elements))
+		for _, e := range v.Elements {
+			elements = append(elements, i.Stringify(e))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *LoxMap:
+		entries := make([]string, 0, len(v.Keys))
+		for _, k := range v.Keys {
+			value, _ := v.Get(k)
+			entries = append(entries, i.Stringify(k)+": "+i.Stringify(value))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *LoxSet:
+		elements := make([]string, 0, v.Len())
+		for _, e := range v.Elements() {
+			elements = append(elements, i.Stringify(e))
+		}
+		return "Set(" + strings.Join(elements, ", ") + ")"
+	case *LoxPersistentList:
+		elements := make([]string, 0)
+		for _, e := range v.Elements() {
+			elements = append(elements, i.Stringify(e))
+		}
+		return "PersistentList(" + strings.Join(elements, ", ") + ")"
+	case *LoxPersistentMap:
+		entries := make([]string, 0)
+		for _, k := range v.Keys() {
+			value, _ := v.lookup(k)
+			entries = append(entries, i.Stringify(k)+": "+i.Stringify(value))
+		}
+		return "PersistentMap({" + strings.Join(entries, ", ") + "})"
+	}
+	return fmt.Sprint(value)
+}
+
+// recordString shows a record's fields, e.g. `Point(x: 1, y: 2)`. it's the `toString()` of
+// records that don't declare their own
+func (i *Interpreter) recordString(record *LoxInstance) string {
+	fields := make([]string, 0, len(record.Klass.RecordFields))
+	for _, field := range record.Klass.RecordFields {
+		fields = append(fields, field+": "+i.Stringify(record.Fields[field]))
+	}
+	return record.Klass.Name + "(" + strings.Join(fields, ", ") + ")"
+}
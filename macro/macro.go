@@ -0,0 +1,69 @@
+package macro
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/resolver"
+	"github.com/weiser/lox/token"
+)
+
+// Expander runs `macro` declarations as the parser reads them, and expands calls to them,
+// e.g. `unless!(done) { work(); }`. macros run in their own interpreter, so they only see
+// the natives and the other macros
+type Expander struct {
+	interpreter *interpreter.Interpreter
+	macros      map[string]bool
+}
+
+func MakeExpander() *Expander {
+	i := interpreter.MakeInterpreter()
+	return &Expander{interpreter: &i, macros: make(map[string]bool)}
+}
+
+func (e *Expander) Define(decl *expr.Macro) (err error) {
+	defer recoverError(&err)
+	r := resolver.Resolver{Interpreter: *e.interpreter, CurrentFunction: resolver.NONE}
+	if !r.ResolveStatements([]expr.StmtInterface{decl.Function}) {
+		return errors.New(r.Errors[0])
+	}
+	e.interpreter.Execute(decl.Function)
+	e.macros[decl.Function.(*expr.Function).Name.Lexeme] = true
+	return nil
+}
+
+// Expand calls the macro with the code of its arguments, and the block after the call as
+// its last argument
+func (e *Expander) Expand(name token.Token, arguments []expr.ExprInterface, body expr.StmtInterface) (stmts []expr.StmtInterface, exp expr.ExprInterface, err error) {
+	defer recoverError(&err)
+	if !e.macros[name.Lexeme] {
+		return nil, nil, fmt.Errorf("undefined macro '%v'", name.Lexeme)
+	}
+	fxn := e.interpreter.Evaluate(&expr.Variable{Name: name}).(interpreter.LoxFunction)
+
+	args := make([]interface{}, 0, len(arguments)+1)
+	for _, argument := range arguments {
+		args = append(args, &interpreter.LoxCode{Expression: argument})
+	}
+	if body != nil {
+		args = append(args, &interpreter.LoxCode{Statements: []expr.StmtInterface{body}})
+	}
+	if len(args) != fxn.Arity() && !(fxn.Variadic() && len(args) > fxn.Arity()) {
+		return nil, nil, fmt.Errorf("macro '%v' expects %v arguments, got %v", name.Lexeme, fxn.Arity(), len(args))
+	}
+
+	code, ok := fxn.Call(e.interpreter, args).(*interpreter.LoxCode)
+	if !ok {
+		return nil, nil, fmt.Errorf("macro '%v' must return quoted code", name.Lexeme)
+	}
+	return code.Statements, code.Expression, nil
+}
+
+// errors raised while running a macro become parse errors at the macro's call
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%v", r)
+	}
+}
@@ -0,0 +1,85 @@
+package macro
+
+import (
+	"testing"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/parser"
+	"github.com/weiser/lox/resolver"
+	"github.com/weiser/lox/scanner"
+	"github.com/weiser/lox/token"
+)
+
+// run parses src with macros, then resolves and interprets the expanded program
+func run(t *testing.T, src string) *interpreter.Interpreter {
+	scanner := scanner.MakeScanner(src)
+	p := parser.Parser{Tokens: scanner.ScanTokens(), Macros: MakeExpander()}
+	stmts, _ := p.Parse()
+	if p.ParsingErr != nil {
+		t.Fatalf("didn't parse, %v", p.ParsingErr)
+	}
+	i := interpreter.MakeInterpreter()
+	r := resolver.Resolver{Interpreter: i, CurrentFunction: resolver.NONE}
+	if !r.ResolveStatements(stmts) {
+		t.Fatalf("didn't resolve, %v", r.Errors)
+	}
+	(&i).Interpret(stmts)
+	return &i
+}
+
+func get(i *interpreter.Interpreter, name string) interface{} {
+	return i.Evaluate(&expr.Variable{Name: token.Token{TokenType: token.IDENTIFIER, Lexeme: name}})
+}
+
+func TestMacros(t *testing.T) {
+	i := run(t, `
+	macro unless(condition, body) {
+		return quote { if (!$condition) $body; };
+	}
+	macro repeat(n, body) {
+		var i = gensym("i");
+		return quote { for (var $i = 0; $i < $n; $i = $i + 1) $body; };
+	}
+	macro swap(a, b) {
+		var tmp = gensym("tmp");
+		return quote { var $tmp = $a; $a = $b; $b = $tmp; };
+	}
+	macro square(x) { return quote($x * $x); }
+
+	var a = 0;
+	unless!(a > 10) { a = 1; }
+	unless!(a < 10) { a = 2; }
+	var i = 0;
+	var count = 0;
+	repeat!(3) { count = count + 1; }
+	var tmp = "mine";
+	var x = 1;
+	var y = 2;
+	swap!(x, y);
+	var sq = square!(a + 2);
+	`)
+	expectations := map[string]interface{}{"a": 1.0, "count": 3.0, "i": 0.0, "tmp": "mine", "x": 2.0, "y": 1.0, "sq": 9.0}
+	for name, expected := range expectations {
+		if v := get(i, name); v != expected {
+			t.Errorf("expected %v = %v, instead %v = %v", name, expected, name, v)
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []string{
+		`nope!(1);`,
+		`macro m(a) { return quote($a); } m!(1, 2);`,
+		`macro m() { return 1; } m!();`,
+		`macro m() { return quote { print 1; }; } var a = m!();`,
+	}
+	for _, src := range tests {
+		scanner := scanner.MakeScanner(src)
+		p := parser.Parser{Tokens: scanner.ScanTokens(), Macros: MakeExpander()}
+		p.Parse()
+		if p.ParsingErr == nil {
+			t.Errorf("expected `%v` to fail to expand", src)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -8,8 +9,10 @@ import (
 )
 
 func main() {
-	// [0] is the program name
-	args := os.Args[1:]
+	flag.BoolVar(&mainhelpers.DisableAssertions, "no-assert", false, "skip assert statements")
+	flag.BoolVar(&mainhelpers.DisableContracts, "no-contracts", false, "skip checking requires and ensures clauses")
+	flag.Parse()
+	args := flag.Args()
 	switch len(args) {
 	case 1:
 		mainhelpers.RunFile(args[0])
@@ -17,7 +20,7 @@ func main() {
 		fmt.Println("Starting mainHelper...")
 		mainhelpers.RunPrompt()
 	default:
-		println("Usage: lox [path to script]")
+		println("Usage: lox [-no-assert] [-no-contracts] [path to script]")
 		os.Exit(1)
 	}
 
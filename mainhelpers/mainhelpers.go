@@ -5,16 +5,28 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/weiser/lox/comptime"
 	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/macro"
 	"github.com/weiser/lox/parser"
 	"github.com/weiser/lox/resolver"
 	"github.com/weiser/lox/scanner"
 	"github.com/weiser/lox/token"
+	"github.com/weiser/lox/typecheck"
 )
 
 var hadError bool
 var interpret *interpreter.Interpreter
 
+// macros stay defined across REPL lines
+var macros = macro.MakeExpander()
+
+// DisableAssertions skips `assert` statements, e.g. for production runs
+var DisableAssertions bool
+
+// DisableContracts skips checking functions' `requires` and `ensures` clauses
+var DisableContracts bool
+
 func RunFile(filePath string) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -31,21 +43,41 @@ func RunFile(filePath string) {
 func Run(data string) {
 	scanner := scanner.MakeScanner(data)
 	toks := scanner.ScanTokens()
-	p := parser.Parser{Tokens: toks}
+	p := parser.Parser{Tokens: toks, Macros: macros}
 	stmts, _ := p.Parse()
 	i := interpreter.MakeInterpreter()
+	i.DisableAssertions = DisableAssertions
+	i.DisableContracts = DisableContracts
 	interpret = &i
 
 	if p.ParsingErr != nil {
 		// try to parse as an expression
 		p1 := parser.Parser{Tokens: toks}
-		fmt.Println(interpret.Evaluate(p1.Expression()))
+		fmt.Println(interpret.Stringify(interpret.Evaluate(p1.Expression())))
 	} else {
+		if err := comptime.Evaluate(stmts); err != nil {
+			fmt.Println("Error! '", err, "'")
+			hadError = true
+			return
+		}
 		resolver := resolver.Resolver{Interpreter: *interpret, CurrentFunction: resolver.NONE}
 		successfullyResolved := resolver.ResolveStatements(stmts)
-		if successfullyResolved {
-			interpret.Interpret(stmts)
+		if !successfullyResolved {
+			for _, err := range resolver.Errors {
+				fmt.Println("Error! '", err, "'")
+			}
+			hadError = true
+			return
+		}
+		checker := typecheck.MakeChecker()
+		if !checker.Check(stmts) {
+			for _, err := range checker.Errors {
+				fmt.Println("Error! '", err, "'")
+			}
+			hadError = true
+			return
 		}
+		interpret.Interpret(stmts)
 	}
 
 }
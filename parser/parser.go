@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/weiser/lox/expr"
 	"github.com/weiser/lox/token"
@@ -20,6 +21,17 @@ type Parser struct {
 	Tokens     []token.Token
 	ParsingErr *ParserError
 	Current    int
+	// Macros runs `macro` declarations and expands calls to them. without it, macros can be
+	// declared but not called
+	Macros Macros
+}
+
+// Macros expands macro calls while parsing, e.g. `unless!(done) { work(); }`, so the
+// resolver only ever sees the expanded code. see macro.Expander
+type Macros interface {
+	Define(macro *expr.Macro) error
+	// Expand returns either the statements or the expression the macro produced
+	Expand(name token.Token, arguments []expr.ExprInterface, body expr.StmtInterface) ([]expr.StmtInterface, expr.ExprInterface, error)
 }
 
 func (p *Parser) Parse() ([]expr.StmtInterface, error) {
@@ -43,31 +55,74 @@ func (p *Parser) Declaration() expr.StmtInterface {
 			}
 		}
 	}()
+	if p.match(token.SEALED) {
+		if _, err := p.consume(token.CLASS, "expect 'class' after 'sealed'"); err != nil {
+			panic(err)
+		}
+		return p.ClassDeclaration(true)
+	}
 	if p.match(token.CLASS) {
-		return p.ClassDeclaration()
+		return p.ClassDeclaration(false)
+	}
+	if p.match(token.ENUM) {
+		return p.EnumDeclaration()
+	}
+	if p.match(token.TRAIT) {
+		return p.TraitDeclaration()
+	}
+	if p.match(token.RECORD) {
+		return p.RecordDeclaration()
+	}
+	if p.checkType(token.AT) {
+		return p.DecoratedFunction("function")
 	}
 	if p.match(token.FUN) {
 		return p.Function("function")
 	}
-	if p.match(token.VAR) {
+	if p.match(token.MACRO) {
+		return p.MacroDeclaration()
+	}
+	if p.match(token.VAR, token.CONST) {
 		return p.VarDeclaration()
 	}
 	return p.Statement()
 }
 
-func (p *Parser) ClassDeclaration() expr.StmtInterface {
+// instances of a sealed class can only set the fields declared with `var` in the class body
+func (p *Parser) ClassDeclaration(sealed bool) expr.StmtInterface {
 	name, err := p.consume(token.IDENTIFIER, "expect class name")
 	if err != nil {
 		panic(err)
 	}
+
+	// `class Money with Comparable, Printable { ... }`
+	traits := make([]expr.ExprInterface, 0)
+	if p.match(token.WITH) {
+		for {
+			trait, err := p.consume(token.IDENTIFIER, "expect trait name after 'with'")
+			if err != nil {
+				panic(err)
+			}
+			traits = append(traits, &expr.Variable{Name: trait})
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
 	_, errlb := p.consume(token.LEFT_BRACE, "expect '{' before class body")
 	if errlb != nil {
 		panic(errlb)
 	}
 
 	methods := make([]expr.StmtInterface, 0)
+	fields := make([]expr.StmtInterface, 0)
 	for !p.checkType(token.RIGHT_BRACE) && !p.isAtEnd() {
-		methods = append(methods, p.Function("method"))
+		if p.match(token.VAR) {
+			fields = append(fields, p.VarDeclaration())
+		} else {
+			methods = append(methods, p.DecoratedFunction("method"))
+		}
 	}
 
 	_, errrb := p.consume(token.RIGHT_BRACE, "expect '}' after class body")
@@ -75,11 +130,139 @@ func (p *Parser) ClassDeclaration() expr.StmtInterface {
 		panic(errrb)
 	}
 
-	return &expr.Class{Name: name, Methods: methods}
+	return &expr.Class{Name: name, Methods: methods, Traits: traits, Fields: fields, Sealed: sealed}
+
+}
+
+// `record Point(x, y)` declares an immutable class with one field per parameter.
+// a body with extra methods is optional: `record Point(x, y) { norm() { ... } }`
+func (p *Parser) RecordDeclaration() expr.StmtInterface {
+	name, err := p.consume(token.IDENTIFIER, "expect record name")
+	if err != nil {
+		panic(err)
+	}
+	if _, err := p.consume(token.LEFT_PAREN, "expect '(' after record name"); err != nil {
+		panic(err)
+	}
+	fields := make([]token.Token, 0)
+	if !p.checkType(token.RIGHT_PAREN) {
+		for {
+			field, err := p.consume(token.IDENTIFIER, "expect field name")
+			if err != nil {
+				panic(err)
+			}
+			fields = append(fields, field)
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+	if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after record fields"); err != nil {
+		panic(err)
+	}
+
+	methods := make([]expr.StmtInterface, 0)
+	if p.match(token.LEFT_BRACE) {
+		for !p.checkType(token.RIGHT_BRACE) && !p.isAtEnd() {
+			methods = append(methods, p.DecoratedFunction("method"))
+		}
+		if _, err := p.consume(token.RIGHT_BRACE, "expect '}' after record body"); err != nil {
+			panic(err)
+		}
+	} else {
+		p.match(token.SEMICOLON)
+	}
+
+	return &expr.Record{Name: name, Fields: fields, Methods: methods}
+}
+
+// a trait is a named set of methods that classes copy in with `with`
+func (p *Parser) TraitDeclaration() expr.StmtInterface {
+	name, err := p.consume(token.IDENTIFIER, "expect trait name")
+	if err != nil {
+		panic(err)
+	}
+	_, err = p.consume(token.LEFT_BRACE, "expect '{' before trait body")
+	if err != nil {
+		panic(err)
+	}
+
+	methods := make([]expr.StmtInterface, 0)
+	for !p.checkType(token.RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.DecoratedFunction("method"))
+	}
 
+	_, err = p.consume(token.RIGHT_BRACE, "expect '}' after trait body")
+	if err != nil {
+		panic(err)
+	}
+
+	return &expr.Trait{Name: name, Methods: methods}
 }
 
+// `enum Color { Red, Green, Blue }`. a trailing comma after the last member is allowed
+func (p *Parser) EnumDeclaration() expr.StmtInterface {
+	name, err := p.consume(token.IDENTIFIER, "expect enum name")
+	if err != nil {
+		panic(err)
+	}
+	_, err = p.consume(token.LEFT_BRACE, "expect '{' before enum members")
+	if err != nil {
+		panic(err)
+	}
+
+	members := make([]token.Token, 0)
+	seen := make(map[string]bool)
+	for !p.checkType(token.RIGHT_BRACE) && !p.isAtEnd() {
+		member, err := p.consume(token.IDENTIFIER, "expect enum member name")
+		if err != nil {
+			panic(err)
+		}
+		if seen[member.Lexeme] {
+			panic(MakeParserError(member, fmt.Sprintf("duplicate enum member '%v'", member.Lexeme)))
+		}
+		// `Enum.values()` lists the members, so a member can't take its name
+		if member.Lexeme == "values" {
+			panic(MakeParserError(member, "enum member can't be named 'values'"))
+		}
+		seen[member.Lexeme] = true
+		members = append(members, member)
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	_, err = p.consume(token.RIGHT_BRACE, "expect '}' after enum members")
+	if err != nil {
+		panic(err)
+	}
+	return &expr.Enum{Name: name, Members: members}
+}
+
+// `@memoize fun fib(n) { ... }`. each decorator is an expression evaluated to a callable that
+// is called with the function; the one nearest the function is applied first
+func (p *Parser) DecoratedFunction(kind string) expr.StmtInterface {
+	decorators := make([]expr.ExprInterface, 0)
+	for p.match(token.AT) {
+		decorators = append(decorators, p.Call())
+	}
+	if kind == "function" {
+		if _, err := p.consume(token.FUN, "expect 'fun' after decorators"); err != nil {
+			panic(err)
+		}
+	}
+	fxn := p.Function(kind).(*expr.Function)
+	// the constructor calls `init` directly, so decorators on it would never run
+	if len(decorators) > 0 && kind == "method" && fxn.Name.Lexeme == "init" {
+		panic(MakeParserError(fxn.Name, "cannot decorate 'init'"))
+	}
+	fxn.Decorators = decorators
+	return fxn
+}
+
+// a `*` before the name, e.g. `fun* range(n) {...}`, declares a generator
 func (p *Parser) Function(kind string) expr.StmtInterface {
+	generator := p.match(token.STAR)
 	name, err := p.consume(token.IDENTIFIER, fmt.Sprintf("Expect %v name", kind))
 	if err != nil {
 		panic(err)
@@ -90,19 +273,28 @@ func (p *Parser) Function(kind string) expr.StmtInterface {
 	}
 
 	parameters := make([]token.Token, 0)
+	paramTypes := make([]token.Token, 0)
+	variadic := false
 	if !p.checkType(token.RIGHT_PAREN) {
-		// consume 1 or more params
+		// consume 1 or more params. a trailing `...name` collects any remaining arguments
+		variadic = p.match(token.DOT_DOT_DOT)
 		param, iderr := p.consume(token.IDENTIFIER, "Expect parameter name")
 		if iderr != nil {
 			panic(iderr)
 		}
 		parameters = append(parameters, param)
+		paramTypes = append(paramTypes, p.TypeAnnotation())
 		for p.match(token.COMMA) {
+			if variadic {
+				panic(MakeParserError(p.previous(), "rest parameter must be the last parameter"))
+			}
+			variadic = p.match(token.DOT_DOT_DOT)
 			param, iderr = p.consume(token.IDENTIFIER, "Expect parameter name")
 			if iderr != nil {
 				panic(iderr)
 			}
 			parameters = append(parameters, param)
+			paramTypes = append(paramTypes, p.TypeAnnotation())
 			if len(parameters) >= 255 {
 				panic(ParserError{Msg: "cannot have more than 255 args in function call"})
 			}
@@ -112,6 +304,21 @@ func (p *Parser) Function(kind string) expr.StmtInterface {
 	if rperr != nil {
 		panic(rperr)
 	}
+	returnType := p.TypeAnnotation()
+
+	// contracts, e.g. `requires x > 0` and `ensures result != nil`
+	requires := make([]*expr.Assert, 0)
+	ensures := make([]*expr.Assert, 0)
+	for p.match(token.REQUIRES, token.ENSURES) {
+		keyword := p.previous()
+		start := p.Current
+		clause := &expr.Assert{Keyword: keyword, Condition: p.Expression(), Source: p.sourceText(start)}
+		if keyword.TokenType == token.REQUIRES {
+			requires = append(requires, clause)
+		} else {
+			ensures = append(ensures, clause)
+		}
+	}
 
 	_, lberr := p.consume(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %v body.", kind))
 	if lberr != nil {
@@ -120,29 +327,144 @@ func (p *Parser) Function(kind string) expr.StmtInterface {
 
 	body := p.BlockStatement()
 	fmt.Println("parsed function")
-	return &expr.Function{Name: name, Params: parameters, Body: body}
+	return &expr.Function{Name: name, Params: parameters, Body: body, Variadic: variadic, Generator: generator, ParamTypes: paramTypes, ReturnType: returnType, Requires: requires, Ensures: ensures}
+}
+
+// `macro name(params) { body }` is a function that runs while the program is parsed. its
+// arguments are the code it's called with, and it returns the code to replace the call with
+func (p *Parser) MacroDeclaration() expr.StmtInterface {
+	macro := &expr.Macro{Keyword: p.previous(), Function: p.Function("macro")}
+	if p.Macros != nil {
+		if err := p.Macros.Define(macro); err != nil {
+			panic(MakeParserError(macro.Keyword, err.Error()))
+		}
+	}
+	return macro
+}
+
+// `name!(args) { block }` as a statement. the arguments and the block are both optional,
+// and the call needs a ';' when there is no block
+func (p *Parser) MacroStatement() expr.StmtInterface {
+	name := p.advance()
+	p.advance()
+	arguments := p.macroArguments()
+	var body expr.StmtInterface
+	if p.match(token.LEFT_BRACE) {
+		body = &expr.Block{Statements: p.BlockStatement()}
+	} else if _, err := p.consume(token.SEMICOLON, "expect ';' after macro call"); err != nil {
+		panic(err)
+	}
+
+	stmts, exp := p.expandMacro(name, arguments, body)
+	if exp != nil {
+		return &expr.Expression{Expression: exp}
+	}
+	if len(stmts) == 1 {
+		return stmts[0]
+	}
+	return &expr.Block{Statements: stmts}
+}
+
+func (p *Parser) macroArguments() []expr.ExprInterface {
+	arguments := make([]expr.ExprInterface, 0)
+	if !p.match(token.LEFT_PAREN) {
+		return arguments
+	}
+	if !p.checkType(token.RIGHT_PAREN) {
+		arguments = append(arguments, p.Expression())
+		for p.match(token.COMMA) {
+			arguments = append(arguments, p.Expression())
+		}
+	}
+	if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after macro arguments"); err != nil {
+		panic(err)
+	}
+	return arguments
+}
+
+func (p *Parser) expandMacro(name token.Token, arguments []expr.ExprInterface, body expr.StmtInterface) ([]expr.StmtInterface, expr.ExprInterface) {
+	if p.Macros == nil {
+		panic(MakeParserError(name, "macros aren't available here"))
+	}
+	stmts, exp, err := p.Macros.Expand(name, arguments, body)
+	if err != nil {
+		panic(MakeParserError(name, err.Error()))
+	}
+	return stmts, exp
+}
+
+// `quote { statements }` or `quote(expression)`
+func (p *Parser) QuoteExpression() expr.ExprInterface {
+	keyword := p.previous()
+	if p.match(token.LEFT_BRACE) {
+		return &expr.Quote{Keyword: keyword, Statements: p.BlockStatement()}
+	}
+	if _, err := p.consume(token.LEFT_PAREN, "expect '(' or '{' after 'quote'"); err != nil {
+		panic(err)
+	}
+	exp := p.Expression()
+	if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after quoted expression"); err != nil {
+		panic(err)
+	}
+	return &expr.Quote{Keyword: keyword, Expression: exp}
+}
+
+// TypeAnnotation parses an optional `: TypeName`. annotations are only used by the
+// typecheck package; an unannotated name gets the zero token
+func (p *Parser) TypeAnnotation() token.Token {
+	if !p.match(token.COLON) {
+		return token.Token{}
+	}
+	typ, err := p.consume(token.IDENTIFIER, "Expect type name after ':'")
+	if err != nil {
+		panic(err)
+	}
+	return typ
 }
 
+// handles both `var` and `const` declarations; a const must be initialized
 func (p *Parser) VarDeclaration() expr.StmtInterface {
+	constant := p.previous().TokenType == token.CONST
 	name, _ := p.consume(token.IDENTIFIER, "Expected variable name")
+	typ := p.TypeAnnotation()
 
 	var initializer expr.ExprInterface
 	if p.match(token.EQUAL) {
 		initializer = p.Expression()
+	} else if constant {
+		panic(MakeParserError(name, "const declarations must have an initializer"))
 	}
 
 	p.consume(token.SEMICOLON, "expected ';' after variable declaration")
-	return &expr.Var{Name: name, Initializer: initializer}
+	return &expr.Var{Name: name, Initializer: initializer, Constant: constant, Type: typ}
 
 }
 
 func (p *Parser) Statement() expr.StmtInterface {
+	if p.checkType(token.IDENTIFIER) && p.checkTypeAt(1, token.BANG) {
+		return p.MacroStatement()
+	}
 	if p.match(token.BREAK) {
 		return p.BreakStatement()
 	}
+	if p.match(token.CONTINUE) {
+		return p.ContinueStatement()
+	}
+	if p.match(token.DO) {
+		return p.DoWhileStatement()
+	}
 	if p.match(token.RETURN) {
 		return p.ReturnStatement()
 	}
+	if p.match(token.YIELD) {
+		return p.YieldStatement()
+	}
+	if p.match(token.DEFER) {
+		return p.DeferStatement()
+	}
+	if p.match(token.ASSERT) {
+		return p.AssertStatement()
+	}
 	if p.match(token.FOR) {
 		return p.ForStatement()
 	}
@@ -161,6 +483,82 @@ func (p *Parser) Statement() expr.StmtInterface {
 	return p.ExpressionStatement()
 }
 
+// `defer f(x);` evaluates f and x now, and calls f(x) when the enclosing function returns
+func (p *Parser) DeferStatement() expr.StmtInterface {
+	keyword := p.previous()
+	call, ok := p.Expression().(*expr.Call)
+	if !ok {
+		panic(MakeParserError(keyword, "can only defer a function call"))
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after deferred call"); err != nil {
+		panic(err)
+	}
+	return &expr.Defer{Keyword: keyword, Call: call}
+}
+
+// `assert condition, "message";` the message is optional
+func (p *Parser) AssertStatement() expr.StmtInterface {
+	keyword := p.previous()
+	start := p.Current
+	condition := p.Expression()
+	source := p.sourceText(start)
+
+	var message expr.ExprInterface
+	if p.match(token.COMMA) {
+		message = p.Expression()
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after assert"); err != nil {
+		panic(err)
+	}
+	return &expr.Assert{Keyword: keyword, Condition: condition, Message: message, Source: source}
+}
+
+// sourceText rebuilds the source of the tokens from start up to the current token, e.g. so a
+// failed assert can show what it checked. tokens don't keep their whitespace, so it's normalized
+func (p *Parser) sourceText(start int) string {
+	var text strings.Builder
+	for ind := start; ind < p.Current; ind++ {
+		if ind > start && spaceBetween(p.Tokens[ind-1], p.Tokens[ind]) && !p.isUnaryMinus(start, ind-1) {
+			text.WriteString(" ")
+		}
+		text.WriteString(p.Tokens[ind].Lexeme)
+	}
+	return text.String()
+}
+
+// a `-` is a negation, not a subtraction, when nothing that ends an operand comes before it
+func (p *Parser) isUnaryMinus(start int, ind int) bool {
+	if p.Tokens[ind].TokenType != token.MINUS {
+		return false
+	}
+	if ind == start {
+		return true
+	}
+	switch p.Tokens[ind-1].TokenType {
+	case token.IDENTIFIER, token.NUMBER, token.STRING, token.RIGHT_PAREN, token.RIGHT_BRACKET, token.THIS, token.TRUE, token.FALSE, token.NIL:
+		return false
+	}
+	return true
+}
+
+func spaceBetween(prev token.Token, next token.Token) bool {
+	switch prev.TokenType {
+	case token.LEFT_PAREN, token.LEFT_BRACKET, token.DOT, token.BANG, token.DOT_DOT, token.DOT_DOT_LESS, token.DOT_DOT_DOT:
+		return false
+	}
+	switch next.TokenType {
+	case token.RIGHT_PAREN, token.RIGHT_BRACKET, token.COMMA, token.DOT, token.COLON, token.DOT_DOT, token.DOT_DOT_LESS:
+		return false
+	case token.LEFT_PAREN, token.LEFT_BRACKET:
+		// calls and indexing, e.g. `f(x)` and `xs[0]`
+		switch prev.TokenType {
+		case token.IDENTIFIER, token.RIGHT_PAREN, token.RIGHT_BRACKET, token.THIS, token.STRING:
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) ReturnStatement() expr.StmtInterface {
 	keywrd := p.previous()
 	var value expr.ExprInterface
@@ -172,6 +570,20 @@ func (p *Parser) ReturnStatement() expr.StmtInterface {
 	return &expr.Return{Keyword: keywrd, Value: value}
 }
 
+func (p *Parser) YieldStatement() expr.StmtInterface {
+	keywrd := p.previous()
+	var value expr.ExprInterface
+	if !p.checkType(token.SEMICOLON) {
+		value = p.Expression()
+	}
+
+	_, err := p.consume(token.SEMICOLON, "Expect ';' after yield value")
+	if err != nil {
+		panic(err)
+	}
+	return &expr.Yield{Keyword: keywrd, Value: value}
+}
+
 func (p *Parser) BreakStatement() expr.StmtInterface {
 	breakStmt := expr.Expression{Expression: &expr.Literal{Value: token.BREAK}}
 	_, err := p.consume(token.SEMICOLON, "Expect ';' after 'break'")
@@ -181,12 +593,45 @@ func (p *Parser) BreakStatement() expr.StmtInterface {
 	return &breakStmt
 }
 
+func (p *Parser) ContinueStatement() expr.StmtInterface {
+	continueStmt := expr.Expression{Expression: &expr.Literal{Value: token.CONTINUE}}
+	_, err := p.consume(token.SEMICOLON, "Expect ';' after 'continue'")
+	if err != nil {
+		panic(err)
+	}
+	return &continueStmt
+}
+
+// `do body while (condition);` runs the body once before checking the condition
+func (p *Parser) DoWhileStatement() expr.StmtInterface {
+	body := p.Statement()
+	if _, err := p.consume(token.WHILE, "Expect 'while' after do loop body"); err != nil {
+		panic(err)
+	}
+	if _, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'"); err != nil {
+		panic(err)
+	}
+	condition := p.Expression()
+	if _, err := p.consume(token.RIGHT_PAREN, "Expect ')' after condition"); err != nil {
+		panic(err)
+	}
+	if _, err := p.consume(token.SEMICOLON, "Expect ';' after do loop"); err != nil {
+		panic(err)
+	}
+	return &expr.DoWhile{Body: body, Condition: condition}
+}
+
 func (p *Parser) ForStatement() expr.StmtInterface {
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'for'")
 	if err != nil {
 		panic(err)
 	}
 
+	if (p.checkType(token.VAR) && p.checkTypeAt(1, token.IDENTIFIER) && p.checkTypeAt(2, token.IN)) ||
+		(p.checkType(token.IDENTIFIER) && p.checkTypeAt(1, token.IN)) {
+		return p.ForInStatement()
+	}
+
 	var initializer expr.StmtInterface
 	if p.match(token.SEMICOLON) {
 		initializer = nil
@@ -216,14 +661,11 @@ func (p *Parser) ForStatement() expr.StmtInterface {
 
 	body := p.Statement()
 
-	if increment != nil {
-		body = &expr.Block{Statements: []expr.StmtInterface{body, &expr.Expression{Expression: increment}}}
-	}
-
 	if condition == nil {
 		condition = &expr.Literal{Value: true}
 	}
-	body = &expr.While{Condition: condition, Body: body}
+	// the increment is part of the While, rather than appended to the body, so `continue` doesn't skip it
+	body = &expr.While{Condition: condition, Body: body, Increment: increment}
 
 	if initializer != nil {
 		body = &expr.Block{Statements: []expr.StmtInterface{initializer, body}}
@@ -233,6 +675,22 @@ func (p *Parser) ForStatement() expr.StmtInterface {
 
 }
 
+// `for (var x in xs) body`. the `var` is optional, the loop variable is always
+// scoped to the loop
+func (p *Parser) ForInStatement() expr.StmtInterface {
+	p.match(token.VAR)
+	name := p.advance()
+	p.advance() // 'in'
+	iterable := p.Expression()
+	_, err := p.consume(token.RIGHT_PAREN, "Expect ')' after for-in iterable")
+	if err != nil {
+		panic(err)
+	}
+	body := p.Statement()
+
+	return &expr.ForIn{Name: name, Iterable: iterable, Body: body}
+}
+
 func (p *Parser) WhileStatement() expr.StmtInterface {
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'")
 	if err != nil {
@@ -346,15 +804,35 @@ func (p *Parser) Equality() expr.ExprInterface {
 }
 
 func (p *Parser) Comparison() expr.ExprInterface {
-	exp := p.Term()
-	for p.match(token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL) {
+	exp := p.Range()
+	for p.match(token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL, token.IS) {
 		operator := p.previous()
-		right := p.Term()
+		if operator.TokenType == token.IS {
+			// `x is Point`, `x is String`: the right side is always the name of a class or kind
+			name, err := p.consume(token.IDENTIFIER, "expect a type name after 'is'")
+			if err != nil {
+				panic(err)
+			}
+			exp = &expr.Is{Object: exp, Operator: operator, Target: &expr.Variable{Name: name}}
+			continue
+		}
+		right := p.Range()
 		exp = &expr.Binary{Right: right, Operator: operator, Left: exp}
 	}
 	return exp
 }
 
+// `a..b` includes b, `a..<b` stops before it. ranges don't chain, so `a..b..c` is an error
+func (p *Parser) Range() expr.ExprInterface {
+	exp := p.Term()
+	if p.match(token.DOT_DOT, token.DOT_DOT_LESS) {
+		operator := p.previous()
+		end := p.Term()
+		exp = &expr.Range{Start: exp, Operator: operator, End: end}
+	}
+	return exp
+}
+
 func (p *Parser) Term() expr.ExprInterface {
 	exp := p.Factor()
 
@@ -377,6 +855,9 @@ func (p *Parser) Factor() expr.ExprInterface {
 }
 
 func (p *Parser) Unary() expr.ExprInterface {
+	if p.match(token.COMPTIME) {
+		return p.ComptimeExpression()
+	}
 	if p.match(token.BANG, token.MINUS) {
 		operator := p.previous()
 		right := p.Unary()
@@ -386,6 +867,20 @@ func (p *Parser) Unary() expr.ExprInterface {
 	return p.Call()
 }
 
+// `comptime expression`, or `comptime { statements }` whose value is what the statements return.
+// see the comptime package
+// `comptime {` starts a block, unless it starts a map literal's first entry, e.g.
+// `comptime {"n": 0}` or `comptime {...defaults}`. a map whose first key is longer than one
+// token needs parentheses, e.g. `comptime ({a + b: 0})`
+func (p *Parser) ComptimeExpression() expr.ExprInterface {
+	keyword := p.previous()
+	isMap := p.checkTypeAt(1, token.DOT_DOT_DOT) || p.checkTypeAt(2, token.COLON)
+	if !isMap && p.match(token.LEFT_BRACE) {
+		return &expr.Comptime{Keyword: keyword, Body: p.BlockStatement()}
+	}
+	return &expr.Comptime{Keyword: keyword, Expression: p.Unary()}
+}
+
 func (p *Parser) Call() expr.ExprInterface {
 	exp := p.Primary()
 
@@ -398,6 +893,13 @@ func (p *Parser) Call() expr.ExprInterface {
 				panic(err)
 			}
 			exp = &expr.Get{Object: exp, Name: name}
+		} else if p.match(token.LEFT_BRACKET) {
+			index := p.Expression()
+			bracket, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after index")
+			if err != nil {
+				panic(err)
+			}
+			exp = &expr.Index{Object: exp, Bracket: bracket, Index: index}
 		} else {
 			break
 		}
@@ -406,15 +908,14 @@ func (p *Parser) Call() expr.ExprInterface {
 	return exp
 }
 
+// the 255 argument limit is checked by the interpreter, since spread arguments
+// are only expanded at runtime
 func (p *Parser) FinishCall(callee expr.ExprInterface) expr.ExprInterface {
 	args := make([]expr.ExprInterface, 0)
 	if !p.checkType(token.RIGHT_PAREN) {
-		args = append(args, p.Expression())
+		args = append(args, p.Argument())
 		for p.match(token.COMMA) {
-			if len(args) >= 255 {
-				panic(ParserError{Msg: "cannot have more than 255 args in function call"})
-			}
-			args = append(args, p.Expression())
+			args = append(args, p.Argument())
 		}
 	}
 
@@ -423,6 +924,67 @@ func (p *Parser) FinishCall(callee expr.ExprInterface) expr.ExprInterface {
 	return &expr.Call{Callee: callee, Paren: paren, Arguments: args}
 }
 
+// an argument is an expression that may be prefixed with `...` to spread it
+// into the surrounding call or list literal
+func (p *Parser) Argument() expr.ExprInterface {
+	if p.match(token.DOT_DOT_DOT) {
+		operator := p.previous()
+		return &expr.Spread{Operator: operator, Expression: p.Expression()}
+	}
+	return p.Expression()
+}
+
+func (p *Parser) ListLiteral() expr.ExprInterface {
+	bracket := p.previous()
+	elements := make([]expr.ExprInterface, 0)
+	if !p.checkType(token.RIGHT_BRACKET) {
+		elements = append(elements, p.Argument())
+		for p.match(token.COMMA) {
+			elements = append(elements, p.Argument())
+		}
+	}
+
+	_, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after list elements")
+	if err != nil {
+		panic(err)
+	}
+	return &expr.List{Bracket: bracket, Elements: elements}
+}
+
+// map entries are either `key: value` or `...otherMap`. a spread entry is
+// stored as a Spread key with a nil value
+func (p *Parser) MapLiteral() expr.ExprInterface {
+	brace := p.previous()
+	keys := make([]expr.ExprInterface, 0)
+	values := make([]expr.ExprInterface, 0)
+	for !p.checkType(token.RIGHT_BRACE) && !p.isAtEnd() {
+		if len(keys) > 0 {
+			_, err := p.consume(token.COMMA, "Expect ',' between map entries")
+			if err != nil {
+				panic(err)
+			}
+		}
+		if p.match(token.DOT_DOT_DOT) {
+			operator := p.previous()
+			keys = append(keys, &expr.Spread{Operator: operator, Expression: p.Expression()})
+			values = append(values, nil)
+			continue
+		}
+		keys = append(keys, p.Expression())
+		_, err := p.consume(token.COLON, "Expect ':' after map key")
+		if err != nil {
+			panic(err)
+		}
+		values = append(values, p.Expression())
+	}
+
+	_, err := p.consume(token.RIGHT_BRACE, "Expect '}' after map entries")
+	if err != nil {
+		panic(err)
+	}
+	return &expr.Map{Brace: brace, Keys: keys, Values: values}
+}
+
 func (p *Parser) Primary() expr.ExprInterface {
 	if p.match(token.FALSE) {
 		return &expr.Literal{Value: false}
@@ -448,8 +1010,28 @@ func (p *Parser) Primary() expr.ExprInterface {
 			panic(err)
 		}
 	}
+	if p.match(token.THIS) {
+		return &expr.This{Keyword: p.previous()}
+	}
 	if p.match(token.IDENTIFIER) {
-		return &expr.Variable{Name: p.previous()}
+		name := p.previous()
+		if p.match(token.BANG) {
+			stmts, exp := p.expandMacro(name, p.macroArguments(), nil)
+			if exp == nil {
+				panic(MakeParserError(name, fmt.Sprintf("macro '%v' expanded to %v statements where an expression was expected", name.Lexeme, len(stmts))))
+			}
+			return exp
+		}
+		return &expr.Variable{Name: name}
+	}
+	if p.match(token.QUOTE) {
+		return p.QuoteExpression()
+	}
+	if p.match(token.LEFT_BRACKET) {
+		return p.ListLiteral()
+	}
+	if p.match(token.LEFT_BRACE) {
+		return p.MapLiteral()
 	}
 	err := MakeParserError(p.peek(), "expected expression")
 	panic(err)
@@ -476,7 +1058,7 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().TokenType {
-		case token.CLASS, token.FOR, token.FUN, token.IF, token.PRINT, token.RETURN, token.VAR, token.WHILE:
+		case token.ASSERT, token.AT, token.CLASS, token.CONST, token.DO, token.ENUM, token.FOR, token.FUN, token.IF, token.MACRO, token.PRINT, token.RECORD, token.RETURN, token.SEALED, token.TRAIT, token.VAR, token.WHILE:
 			return
 		}
 		p.advance()
@@ -500,6 +1082,14 @@ func (p *Parser) checkType(typ token.TType) bool {
 	return p.peek().TokenType == typ
 }
 
+// checkTypeAt looks `offset` tokens past the current one
+func (p *Parser) checkTypeAt(offset int, typ token.TType) bool {
+	if p.Current+offset >= len(p.Tokens) {
+		return false
+	}
+	return p.Tokens[p.Current+offset].TokenType == typ
+}
+
 func (p *Parser) advance() token.Token {
 	if !p.isAtEnd() {
 		p.Current += 1
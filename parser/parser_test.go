@@ -79,3 +79,350 @@ func TestClassStmt(t *testing.T) {
 		t.Errorf("expected a Class statement, got a %v", stmts[0])
 	}
 }
+
+func TestSpreadArguments(t *testing.T) {
+	scanner := scanner.MakeScanner(`f(1, ...[2, 3]);`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	call, ok := stmts[0].(*expr.Expression).Expression.(*expr.Call)
+	if !ok {
+		t.Fatalf("expected a Call expression, got a %v", stmts[0])
+	}
+	spread, ok := call.Arguments[1].(*expr.Spread)
+	if !ok {
+		t.Fatalf("expected a Spread argument, got a %v", call.Arguments[1])
+	}
+	if _, ok := spread.Expression.(*expr.List); !ok {
+		t.Errorf("expected a List to be spread, got a %v", spread.Expression)
+	}
+}
+
+func TestVariadicFunction(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun f(a, ...rest) { return rest; }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	fxn, ok := stmts[0].(*expr.Function)
+	if !ok {
+		t.Fatalf("expected a Function statement, got a %v", stmts[0])
+	}
+	if !fxn.Variadic || len(fxn.Params) != 2 {
+		t.Errorf("expected a variadic function with 2 params, got %v", fxn)
+	}
+}
+
+func TestGeneratorFunction(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun* g() { yield 1; }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	fxn, ok := stmts[0].(*expr.Function)
+	if !ok || !fxn.Generator {
+		t.Fatalf("expected a generator Function statement, got a %v", stmts[0])
+	}
+	if _, ok := fxn.Body[0].(*expr.Yield); !ok {
+		t.Errorf("expected a Yield statement, got a %v", fxn.Body[0])
+	}
+}
+
+func TestForInStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`for (var x in xs) print x;`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	forIn, ok := stmts[0].(*expr.ForIn)
+	if !ok {
+		t.Fatalf("expected a ForIn statement, got a %v", stmts[0])
+	}
+	if forIn.Name.Lexeme != "x" {
+		t.Errorf("expected loop variable x, got %v", forIn.Name)
+	}
+}
+
+func TestRangeExpr(t *testing.T) {
+	scanner := scanner.MakeScanner(`var r = 0..<n - 1;`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	v := stmts[0].(*expr.Var)
+	r, ok := v.Initializer.(*expr.Range)
+	if !ok {
+		t.Fatalf("expected a Range expression, got a %v", v.Initializer)
+	}
+	if _, ok := r.End.(*expr.Binary); !ok {
+		t.Errorf("expected the range to end at a Binary expression, got a %v", r.End)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun add(a: Number, b): Number { return a + b; } var s: String = "s";`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	fxn := stmts[0].(*expr.Function)
+	if fxn.ParamTypes[0].Lexeme != "Number" || fxn.ParamTypes[1].Lexeme != "" || fxn.ReturnType.Lexeme != "Number" {
+		t.Errorf("expected annotations (Number, none): Number, got %v %v", fxn.ParamTypes, fxn.ReturnType)
+	}
+	if v := stmts[1].(*expr.Var); v.Type.Lexeme != "String" {
+		t.Errorf("expected a String annotation, got %v", v.Type)
+	}
+}
+
+func TestEnumStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`enum Color { Red, Green, Blue, }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	enum, ok := stmts[0].(*expr.Enum)
+	if !ok {
+		t.Fatalf("expected an Enum statement, got a %v", stmts[0])
+	}
+	if len(enum.Members) != 3 {
+		t.Errorf("expected 3 members, got %v", enum.Members)
+	}
+}
+
+func TestEnumMemberNamedValues(t *testing.T) {
+	scanner := scanner.MakeScanner(`enum E { keys, values }`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	p.Parse()
+	if p.ParsingErr == nil {
+		t.Errorf("expected an enum member named values to fail")
+	}
+}
+
+func TestTraitStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	trait Comparable { lessThan(o) { return false; } }
+	class Money with Comparable, Printable {}
+	`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	trait, ok := stmts[0].(*expr.Trait)
+	if !ok {
+		t.Fatalf("expected a Trait statement, got a %v", stmts[0])
+	}
+	if len(trait.Methods) != 1 {
+		t.Errorf("expected 1 method, got %v", trait.Methods)
+	}
+	class, ok := stmts[1].(*expr.Class)
+	if !ok {
+		t.Fatalf("expected a Class statement, got a %v", stmts[1])
+	}
+	if len(class.Traits) != 2 {
+		t.Errorf("expected 2 traits, got %v", class.Traits)
+	}
+}
+
+func TestIsExpr(t *testing.T) {
+	scanner := scanner.MakeScanner(`x + 1 is Number;`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	exp, ok := stmts[0].(*expr.Expression).Expression.(*expr.Is)
+	if !ok {
+		t.Fatalf("expected an Is expression, got a %v", stmts[0].(*expr.Expression).Expression)
+	}
+	if _, ok := exp.Object.(*expr.Binary); !ok {
+		t.Errorf("expected 'is' to bind looser than '+', got %v", exp.Object)
+	}
+	if target := exp.Target.(*expr.Variable).Name.Lexeme; target != "Number" {
+		t.Errorf("expected the target to be Number, got %v", target)
+	}
+}
+
+func TestFieldDeclarations(t *testing.T) {
+	scanner := scanner.MakeScanner(`sealed class P { var x = 0; var y; init() {} }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	class, ok := stmts[0].(*expr.Class)
+	if !ok {
+		t.Fatalf("expected a Class statement, got a %v", stmts[0])
+	}
+	if !class.Sealed {
+		t.Errorf("expected the class to be sealed")
+	}
+	if len(class.Fields) != 2 || len(class.Methods) != 1 {
+		t.Errorf("expected 2 fields and 1 method, got %v and %v", class.Fields, class.Methods)
+	}
+}
+
+func TestRecordStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`record Point(x, y) record Line(a, b) { length() { return 0; } }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %v", stmts)
+	}
+	point, ok := stmts[0].(*expr.Record)
+	if !ok {
+		t.Fatalf("expected a Record statement, got a %v", stmts[0])
+	}
+	if len(point.Fields) != 2 {
+		t.Errorf("expected 2 fields, got %v", point.Fields)
+	}
+	if line := stmts[1].(*expr.Record); len(line.Methods) != 1 {
+		t.Errorf("expected 1 method, got %v", line.Methods)
+	}
+}
+
+func TestDecoratedFunction(t *testing.T) {
+	scanner := scanner.MakeScanner(`
+	@memoize @deprecated("use g")
+	fun f(n) { return n; }
+	class C { @memoize m() {} }
+	`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	fxn, ok := stmts[0].(*expr.Function)
+	if !ok {
+		t.Fatalf("expected a Function statement, got a %v", stmts[0])
+	}
+	if len(fxn.Decorators) != 2 {
+		t.Errorf("expected 2 decorators, got %v", fxn.Decorators)
+	}
+	if _, ok := fxn.Decorators[1].(*expr.Call); !ok {
+		t.Errorf("expected the second decorator to be a call, got %v", fxn.Decorators[1])
+	}
+	method := stmts[1].(*expr.Class).Methods[0].(*expr.Function)
+	if len(method.Decorators) != 1 {
+		t.Errorf("expected 1 decorator on the method, got %v", method.Decorators)
+	}
+}
+
+func TestDecoratedInit(t *testing.T) {
+	scanner := scanner.MakeScanner(`class C { @memoize init() {} }`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	p.Parse()
+	if p.ParsingErr == nil {
+		t.Errorf("expected decorating init to fail")
+	}
+}
+
+func TestDeferStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun f() { defer close(file); }`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	body := stmts[0].(*expr.Function).Body
+	if _, ok := body[0].(*expr.Defer); !ok {
+		t.Errorf("expected a Defer statement, got a %v", body[0])
+	}
+}
+
+func TestDeferNonCall(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun f() { defer file; }`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	p.Parse()
+	if p.ParsingErr == nil {
+		t.Errorf("expected deferring something other than a call to fail")
+	}
+}
+
+func TestDoWhileStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`do { continue; } while (x);`)
+	toks := scanner.ScanTokens()
+	p := Parser{Tokens: toks}
+	stmts, _ := p.Parse()
+
+	loop, ok := stmts[0].(*expr.DoWhile)
+	if !ok {
+		t.Fatalf("expected a DoWhile statement, got a %v", stmts[0])
+	}
+	if _, ok := loop.Condition.(*expr.Variable); !ok {
+		t.Errorf("expected the condition to be x, got %v", loop.Condition)
+	}
+}
+
+func TestAssertStmt(t *testing.T) {
+	scanner := scanner.MakeScanner(`assert !done and xs[i].size(1, 2) >= -1 - n, "message";`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	stmts, _ := p.Parse()
+
+	assert, ok := stmts[0].(*expr.Assert)
+	if !ok {
+		t.Fatalf("expected an Assert statement, got a %v", stmts[0])
+	}
+	if expected := "!done and xs[i].size(1, 2) >= -1 - n"; assert.Source != expected {
+		t.Errorf("expected the source to be %q, got %q", expected, assert.Source)
+	}
+	if assert.Message == nil {
+		t.Errorf("expected a message")
+	}
+}
+
+func TestMacroAndQuote(t *testing.T) {
+	scanner := scanner.MakeScanner(`macro m(x) { return quote { print $x; }; } var q = quote(1 + 2);`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	stmts, _ := p.Parse()
+
+	if _, ok := stmts[0].(*expr.Macro); !ok {
+		t.Errorf("expected a Macro statement, got a %v", stmts[0])
+	}
+	q := stmts[1].(*expr.Var).Initializer.(*expr.Quote)
+	if _, ok := q.Expression.(*expr.Binary); !ok {
+		t.Errorf("expected a quoted Binary expression, got %v", q.Expression)
+	}
+}
+
+func TestMacroCallWithoutExpander(t *testing.T) {
+	scanner := scanner.MakeScanner(`unless!(done) { work(); }`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	p.Parse()
+	if p.ParsingErr == nil {
+		t.Errorf("expected a macro call to fail without an expander")
+	}
+}
+
+func TestComptimeExpr(t *testing.T) {
+	scanner := scanner.MakeScanner(`var a = comptime 1 + 2; var b = comptime { return 1; }; var c = comptime {"n": 0};`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	stmts, _ := p.Parse()
+
+	// comptime binds like a unary operator
+	sum, ok := stmts[0].(*expr.Var).Initializer.(*expr.Binary)
+	if !ok {
+		t.Fatalf("expected a Binary expression, got %v", stmts[0].(*expr.Var).Initializer)
+	}
+	if _, ok := sum.Left.(*expr.Comptime); !ok {
+		t.Errorf("expected comptime 1 on the left, got %v", sum.Left)
+	}
+	if c, ok := stmts[1].(*expr.Var).Initializer.(*expr.Comptime); !ok || len(c.Body) != 1 {
+		t.Errorf("expected a comptime block, got %v", stmts[1].(*expr.Var).Initializer)
+	}
+	if c, ok := stmts[2].(*expr.Var).Initializer.(*expr.Comptime); !ok || c.Expression == nil {
+		t.Errorf("expected a comptime map literal, got %v", stmts[2].(*expr.Var).Initializer)
+	}
+}
+
+func TestContractClauses(t *testing.T) {
+	scanner := scanner.MakeScanner(`fun f(x) requires x > 0 ensures result != nil ensures result < x { return x; }`)
+	p := Parser{Tokens: scanner.ScanTokens()}
+	stmts, _ := p.Parse()
+
+	fxn := stmts[0].(*expr.Function)
+	if len(fxn.Requires) != 1 || fxn.Requires[0].Source != "x > 0" {
+		t.Errorf("expected to require x > 0, got %v", fxn.Requires)
+	}
+	if len(fxn.Ensures) != 2 || fxn.Ensures[1].Source != "result < x" {
+		t.Errorf("expected two ensures clauses, got %v", fxn.Ensures)
+	}
+}
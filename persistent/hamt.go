@@ -0,0 +1,261 @@
+package persistent
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"reflect"
+)
+
+// Map is a persistent map, stored as a hash array mapped trie: each level of the trie uses the
+// next 5 bits of a key's hash to pick a child, and a bitmap records which children exist so a
+// node only stores those. Get, Set and Delete take O(log32 n) time and copy one path of nodes.
+// keys must be comparable with ==
+type Map struct {
+	count int
+	root  *hamtNode
+	hash  func(key interface{}) uint32
+}
+
+type entry struct {
+	key   interface{}
+	value interface{}
+}
+
+// hamtNode's children are *entry, *hamtNode or *collision
+type hamtNode struct {
+	bitmap   uint32
+	children []interface{}
+}
+
+// collision holds the entries whose keys have the same hash
+type collision struct {
+	hash    uint32
+	entries []*entry
+}
+
+func EmptyMap() *Map {
+	return &Map{hash: Hash}
+}
+
+// Hash hashes a key consistently with ==. pointers are hashed by identity
+func Hash(key interface{}) uint32 {
+	h := fnv.New32a()
+	switch k := key.(type) {
+	case nil:
+		return 0
+	case float64:
+		// +0 makes -0 hash like 0, since they're ==
+		fmt.Fprintf(h, "f%v", math.Float64bits(k+0))
+	case string:
+		fmt.Fprintf(h, "s%v", k)
+	default:
+		if reflect.ValueOf(key).Kind() == reflect.Ptr {
+			fmt.Fprintf(h, "%T(%p)", key, key)
+		} else {
+			fmt.Fprintf(h, "%#v", key)
+		}
+	}
+	return h.Sum32()
+}
+
+func (m *Map) Len() int {
+	return m.count
+}
+
+func (m *Map) Get(key interface{}) (interface{}, bool) {
+	hash := m.hash(key)
+	var child interface{} = m.root
+	for shift := uint(0); ; shift += levelBits {
+		switch n := child.(type) {
+		case *hamtNode:
+			if n == nil {
+				return nil, false
+			}
+			bit := uint32(1) << ((hash >> shift) & mask)
+			if n.bitmap&bit == 0 {
+				return nil, false
+			}
+			child = n.children[n.index(bit)]
+		case *entry:
+			if n.key == key {
+				return n.value, true
+			}
+			return nil, false
+		case *collision:
+			for _, e := range n.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+	}
+}
+
+// index is where the child for bit is in children
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (m *Map) Set(key interface{}, value interface{}) *Map {
+	root := m.root
+	if root == nil {
+		root = &hamtNode{}
+	}
+	newRoot, added := m.set(root, 0, m.hash(key), &entry{key: key, value: value})
+	count := m.count
+	if added {
+		count += 1
+	}
+	return &Map{count: count, root: newRoot, hash: m.hash}
+}
+
+func (m *Map) set(n *hamtNode, shift uint, hash uint32, e *entry) (*hamtNode, bool) {
+	bit := uint32(1) << ((hash >> shift) & mask)
+	idx := n.index(bit)
+	if n.bitmap&bit == 0 {
+		children := make([]interface{}, 0, len(n.children)+1)
+		children = append(children, n.children[:idx]...)
+		children = append(children, e)
+		children = append(children, n.children[idx:]...)
+		return &hamtNode{bitmap: n.bitmap | bit, children: children}, true
+	}
+
+	var child interface{}
+	added := true
+	switch c := n.children[idx].(type) {
+	case *hamtNode:
+		child, added = m.set(c, shift+levelBits, hash, e)
+	case *entry:
+		if c.key == e.key {
+			child, added = e, false
+		} else {
+			child = m.merge(shift+levelBits, c, m.hash(c.key), e, hash)
+		}
+	case *collision:
+		if c.hash != hash {
+			child = m.merge(shift+levelBits, c, c.hash, e, hash)
+			break
+		}
+		entries := append([]*entry{}, c.entries...)
+		for ind, existing := range entries {
+			if existing.key == e.key {
+				entries[ind] = e
+				added = false
+			}
+		}
+		if added {
+			entries = append(entries, e)
+		}
+		child = &collision{hash: hash, entries: entries}
+	}
+	children := append([]interface{}{}, n.children...)
+	children[idx] = child
+	return &hamtNode{bitmap: n.bitmap, children: children}, added
+}
+
+// merge makes the subtree holding an existing child (an entry or collision) and a new entry,
+// whose hashes agree up to shift
+func (m *Map) merge(shift uint, existing interface{}, existingHash uint32, e *entry, hash uint32) interface{} {
+	if existingHash == hash {
+		return &collision{hash: hash, entries: []*entry{existing.(*entry), e}}
+	}
+	i1 := (existingHash >> shift) & mask
+	i2 := (hash >> shift) & mask
+	if i1 == i2 {
+		return &hamtNode{bitmap: 1 << i1, children: []interface{}{m.merge(shift+levelBits, existing, existingHash, e, hash)}}
+	}
+	if i1 < i2 {
+		return &hamtNode{bitmap: 1<<i1 | 1<<i2, children: []interface{}{existing, e}}
+	}
+	return &hamtNode{bitmap: 1<<i1 | 1<<i2, children: []interface{}{e, existing}}
+}
+
+// Delete returns a map without key. if key isn't there, it returns m
+func (m *Map) Delete(key interface{}) *Map {
+	if m.root == nil {
+		return m
+	}
+	newRoot, removed := m.delete(m.root, 0, m.hash(key), key)
+	if !removed {
+		return m
+	}
+	return &Map{count: m.count - 1, root: newRoot, hash: m.hash}
+}
+
+// delete returns nil when the node ends up empty
+func (m *Map) delete(n *hamtNode, shift uint, hash uint32, key interface{}) (*hamtNode, bool) {
+	bit := uint32(1) << ((hash >> shift) & mask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	idx := n.index(bit)
+
+	var child interface{}
+	switch c := n.children[idx].(type) {
+	case *hamtNode:
+		sub, removed := m.delete(c, shift+levelBits, hash, key)
+		if !removed {
+			return n, false
+		}
+		if sub != nil {
+			child = sub
+		}
+	case *entry:
+		if c.key != key {
+			return n, false
+		}
+	case *collision:
+		entries := make([]*entry, 0, len(c.entries))
+		for _, e := range c.entries {
+			if e.key != key {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == len(c.entries) {
+			return n, false
+		}
+		if len(entries) == 1 {
+			child = entries[0]
+		} else {
+			child = &collision{hash: c.hash, entries: entries}
+		}
+	}
+
+	if child != nil {
+		children := append([]interface{}{}, n.children...)
+		children[idx] = child
+		return &hamtNode{bitmap: n.bitmap, children: children}, true
+	}
+	if len(n.children) == 1 {
+		return nil, true
+	}
+	children := make([]interface{}, 0, len(n.children)-1)
+	children = append(children, n.children[:idx]...)
+	children = append(children, n.children[idx+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, children: children}, true
+}
+
+// Each calls fn with every key and value, in an order that depends on the keys' hashes
+func (m *Map) Each(fn func(key interface{}, value interface{})) {
+	if m.root != nil {
+		each(m.root, fn)
+	}
+}
+
+func each(child interface{}, fn func(key interface{}, value interface{})) {
+	switch c := child.(type) {
+	case *hamtNode:
+		for _, grandchild := range c.children {
+			each(grandchild, fn)
+		}
+	case *entry:
+		fn(c.key, c.value)
+	case *collision:
+		for _, e := range c.entries {
+			fn(e.key, e.value)
+		}
+	}
+}
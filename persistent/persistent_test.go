@@ -0,0 +1,124 @@
+package persistent
+
+import (
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	// enough elements for a trie three levels deep
+	n := 40000
+	versions := []*Vector{EmptyVector()}
+	v := EmptyVector()
+	for i := 0; i < n; i++ {
+		v = v.Append(float64(i))
+		if i%1000 == 0 {
+			versions = append(versions, v)
+		}
+	}
+	if v.Len() != n {
+		t.Fatalf("expected %v elements, got %v", n, v.Len())
+	}
+	for i := 0; i < n; i++ {
+		if e, _ := v.Get(i); e != float64(i) {
+			t.Fatalf("expected element %v to be %v, got %v", i, i, e)
+		}
+	}
+	if _, ok := v.Get(n); ok {
+		t.Errorf("expected Get past the end to fail")
+	}
+
+	updated := v.Set(5, "five").Set(n-1, "last")
+	if e, _ := updated.Get(5); e != "five" {
+		t.Errorf("expected the updated element, got %v", e)
+	}
+	if e, _ := v.Get(5); e != 5.0 {
+		t.Errorf("expected the old version to be unchanged, got %v", e)
+	}
+	if e, _ := updated.Get(n - 1); e != "last" {
+		t.Errorf("expected the updated tail, got %v", e)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		v = v.Pop()
+		if v.Len() != i {
+			t.Fatalf("expected %v elements after popping, got %v", i, v.Len())
+		}
+		if i > 0 {
+			if e, _ := v.Get(i - 1); e != float64(i-1) {
+				t.Fatalf("expected the last element to be %v, got %v", i-1, e)
+			}
+		}
+	}
+	for ind, version := range versions[1:] {
+		if version.Len() != ind*1000+1 {
+			t.Errorf("expected version %v to keep its length, got %v", ind, version.Len())
+		}
+	}
+	if elements := versions[2].Elements(); len(elements) != 1001 || elements[1000] != 1000.0 {
+		t.Errorf("expected the elements 0 to 1000, got %v", elements)
+	}
+}
+
+func TestMap(t *testing.T) {
+	n := 5000
+	m := EmptyMap()
+	for i := 0; i < n; i++ {
+		m = m.Set(float64(i), i)
+	}
+	old := m
+	m = m.Set(1.0, "one").Set("a", true)
+	if m.Len() != n+1 {
+		t.Errorf("expected %v entries, got %v", n+1, m.Len())
+	}
+	if v, _ := m.Get(1.0); v != "one" {
+		t.Errorf("expected the updated value, got %v", v)
+	}
+	if v, _ := old.Get(1.0); v != 1 {
+		t.Errorf("expected the old version to be unchanged, got %v", v)
+	}
+
+	for i := 0; i < n; i += 2 {
+		m = m.Delete(float64(i))
+	}
+	if m.Len() != n/2+1 {
+		t.Errorf("expected %v entries after deleting, got %v", n/2+1, m.Len())
+	}
+	for i := 0; i < n; i++ {
+		_, ok := m.Get(float64(i))
+		if ok != (i%2 == 1) {
+			t.Fatalf("expected Get(%v) to be %v", i, i%2 == 1)
+		}
+	}
+	if m.Delete("missing") != m {
+		t.Errorf("expected deleting a missing key to return the same map")
+	}
+
+	count := 0
+	old.Each(func(key interface{}, value interface{}) { count += 1 })
+	if count != n {
+		t.Errorf("expected Each to visit %v entries, visited %v", n, count)
+	}
+}
+
+func TestMapCollisions(t *testing.T) {
+	// every key has the same hash except "other"
+	m := &Map{hash: func(key interface{}) uint32 {
+		if key == "other" {
+			return 1
+		}
+		return 0
+	}}
+	m = m.Set("a", 1).Set("b", 2).Set("c", 3).Set("b", 20).Set("other", 4)
+	if m.Len() != 4 {
+		t.Errorf("expected 4 entries, got %v", m.Len())
+	}
+	for key, expected := range map[string]int{"a": 1, "b": 20, "c": 3, "other": 4} {
+		if v, _ := m.Get(key); v != expected {
+			t.Errorf("expected %v = %v, got %v", key, expected, v)
+		}
+	}
+	m = m.Delete("a").Delete("c")
+	if v, ok := m.Get("b"); !ok || v != 20 || m.Len() != 2 {
+		t.Errorf("expected only b and other to be left, got %v entries", m.Len())
+	}
+}
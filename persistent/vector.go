@@ -0,0 +1,197 @@
+// Package persistent has immutable collections whose updates return a new version that shares
+// most of its structure with the old one, so keeping every version around is cheap.
+package persistent
+
+const levelBits = 5
+const width = 1 << levelBits
+const mask = width - 1
+
+// vectorNode is a node of a Vector's trie. the children of an inner node are *vectorNode,
+// the children of a leaf are the elements
+type vectorNode struct {
+	children [width]interface{}
+}
+
+// Vector is a persistent list, stored as a 32 way trie of its elements. the last (up to) 32
+// elements are kept out of the trie in tail, so appending usually only copies the tail.
+// Get, Set, Append and Pop take O(log32 n) time
+type Vector struct {
+	count int
+	// how far to shift an index to find its child of the root
+	shift uint
+	root  *vectorNode
+	tail  []interface{}
+}
+
+func EmptyVector() *Vector {
+	return &Vector{shift: levelBits, root: &vectorNode{}, tail: []interface{}{}}
+}
+
+func MakeVector(elements []interface{}) *Vector {
+	v := EmptyVector()
+	for _, element := range elements {
+		v = v.Append(element)
+	}
+	return v
+}
+
+func (v *Vector) Len() int {
+	return v.count
+}
+
+// tailOffset is the index of the first element in the tail
+func (v *Vector) tailOffset() int {
+	if v.count < width {
+		return 0
+	}
+	return ((v.count - 1) >> levelBits) << levelBits
+}
+
+// leaf finds the elements of the leaf holding index i
+func (v *Vector) leaf(i int) []interface{} {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	n := v.root
+	for level := v.shift; level > 0; level -= levelBits {
+		n = n.children[(i>>level)&mask].(*vectorNode)
+	}
+	return n.children[:]
+}
+
+func (v *Vector) Get(i int) (interface{}, bool) {
+	if i < 0 || i >= v.count {
+		return nil, false
+	}
+	return v.leaf(i)[i&mask], true
+}
+
+// Elements copies the elements into a slice
+func (v *Vector) Elements() []interface{} {
+	elements := make([]interface{}, 0, v.count)
+	for i := 0; i < v.count; i += width {
+		leaf := v.leaf(i)
+		for j := 0; j < width && i+j < v.count; j++ {
+			elements = append(elements, leaf[j])
+		}
+	}
+	return elements
+}
+
+func (v *Vector) Append(value interface{}) *Vector {
+	if v.count-v.tailOffset() < width {
+		tail := make([]interface{}, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = value
+		return &Vector{count: v.count + 1, shift: v.shift, root: v.root, tail: tail}
+	}
+
+	// the tail is full, so it moves into the trie
+	tailNode := &vectorNode{}
+	copy(tailNode.children[:], v.tail)
+	shift := v.shift
+	var root *vectorNode
+	if (v.count >> levelBits) > (1 << v.shift) {
+		// the trie is full too, so it gets a new root
+		root = &vectorNode{}
+		root.children[0] = v.root
+		root.children[1] = newPath(v.shift, tailNode)
+		shift += levelBits
+	} else {
+		root = v.pushTail(v.shift, v.root, tailNode)
+	}
+	return &Vector{count: v.count + 1, shift: shift, root: root, tail: []interface{}{value}}
+}
+
+func (v *Vector) pushTail(level uint, parent *vectorNode, tailNode *vectorNode) *vectorNode {
+	subidx := ((v.count - 1) >> level) & mask
+	copied := *parent
+	if level == levelBits {
+		copied.children[subidx] = tailNode
+	} else if child, ok := parent.children[subidx].(*vectorNode); ok {
+		copied.children[subidx] = v.pushTail(level-levelBits, child, tailNode)
+	} else {
+		copied.children[subidx] = newPath(level-levelBits, tailNode)
+	}
+	return &copied
+}
+
+// newPath makes the chain of nodes from level down to node
+func newPath(level uint, node *vectorNode) *vectorNode {
+	if level == 0 {
+		return node
+	}
+	n := &vectorNode{}
+	n.children[0] = newPath(level-levelBits, node)
+	return n
+}
+
+// Set returns a vector with the element at i replaced. i must be in range
+func (v *Vector) Set(i int, value interface{}) *Vector {
+	if i >= v.tailOffset() {
+		tail := append([]interface{}{}, v.tail...)
+		tail[i&mask] = value
+		return &Vector{count: v.count, shift: v.shift, root: v.root, tail: tail}
+	}
+	return &Vector{count: v.count, shift: v.shift, root: setIn(v.shift, v.root, i, value), tail: v.tail}
+}
+
+func setIn(level uint, n *vectorNode, i int, value interface{}) *vectorNode {
+	copied := *n
+	if level == 0 {
+		copied.children[i&mask] = value
+	} else {
+		subidx := (i >> level) & mask
+		copied.children[subidx] = setIn(level-levelBits, n.children[subidx].(*vectorNode), i, value)
+	}
+	return &copied
+}
+
+// Pop returns a vector without its last element. popping an empty vector returns it unchanged
+func (v *Vector) Pop() *Vector {
+	switch {
+	case v.count == 0:
+		return v
+	case v.count == 1:
+		return EmptyVector()
+	case v.count-v.tailOffset() > 1:
+		tail := append([]interface{}{}, v.tail[:len(v.tail)-1]...)
+		return &Vector{count: v.count - 1, shift: v.shift, root: v.root, tail: tail}
+	}
+
+	// the tail becomes empty, so the last leaf of the trie becomes the tail
+	tail := append([]interface{}{}, v.leaf(v.count-2)...)
+	root := v.popTail(v.shift, v.root)
+	if root == nil {
+		root = &vectorNode{}
+	}
+	shift := v.shift
+	if shift > levelBits && root.children[1] == nil {
+		root = root.children[0].(*vectorNode)
+		shift -= levelBits
+	}
+	return &Vector{count: v.count - 1, shift: shift, root: root, tail: tail}
+}
+
+// popTail removes the last leaf from the trie, returning nil if that leaves n empty
+func (v *Vector) popTail(level uint, n *vectorNode) *vectorNode {
+	subidx := ((v.count - 2) >> level) & mask
+	copied := *n
+	if level > levelBits {
+		child := v.popTail(level-levelBits, n.children[subidx].(*vectorNode))
+		if child == nil && subidx == 0 {
+			return nil
+		}
+		if child == nil {
+			copied.children[subidx] = nil
+		} else {
+			copied.children[subidx] = child
+		}
+		return &copied
+	}
+	if subidx == 0 {
+		return nil
+	}
+	copied.children[subidx] = nil
+	return &copied
+}
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/golang-collections/collections/stack"
 	"github.com/weiser/lox/expr"
@@ -9,7 +10,13 @@ import (
 	"github.com/weiser/lox/token"
 )
 
-type Scope map[string]bool
+// Binding is what the resolver knows about a name declared in a local scope
+type Binding struct {
+	Defined bool
+	Const   bool
+}
+
+type Scope map[string]Binding
 
 type Stack struct {
 	stack.Stack
@@ -22,27 +29,39 @@ const (
 	NONE FunctionType = iota
 	FUNCTION
 	METHOD
+	GENERATOR
+)
+
+type ClassType int
+
+const (
+	NOCLASS ClassType = iota
+	CLASS
+	TRAIT
 )
 
 type Resolver struct {
 	Interpreter     interpreter.Interpreter
 	Scopes          Stack
 	CurrentFunction FunctionType
+	CurrentClass    ClassType
+	// every error found while resolving, in the order they were found
+	Errors []string
+	// method names of each trait declared so far, to find conflicts between traits
+	Traits map[string][]string
+	// how many loops enclose the current statement within the current function
+	loops int
 }
 
-// Get's the ith item in the stack.  retains order of stack
+// Get's the ith item in the stack, counting from the bottom.  retains order of stack
 func (s *Stack) Get(i int) interface{} {
 	oldStack := stack.Stack{}
-	if i == 0 {
-		return s.Peek()
-	}
-	var ith interface{}
-	for ind := 0; ind < i; ind += 1 {
-		ith = s.Pop()
-		oldStack.Push(ith)
+	for s.Len() > i+1 {
+		oldStack.Push(s.Pop())
 	}
+	ith := s.Peek()
 	for oldStack.Len() != 0 {
-		s.Push(oldStack.Pop)
+		s.Push(oldStack.Pop())
 	}
 	return ith
 }
@@ -50,6 +69,9 @@ func (s *Stack) Get(i int) interface{} {
 func (r *Resolver) VisitExpr(e *expr.Expr) interface{} { return nil }
 func (r *Resolver) VisitAssign(e *expr.Assign) interface{} {
 	r.resolveExpression(e.Value)
+	if binding, ok := r.lookup(e.Name); ok && binding.Const {
+		panic(fmt.Sprintf("%v: cannot assign to constant '%v'", e.Name, e.Name.Lexeme))
+	}
 	r.resolveLocal(e, e.Name)
 	return nil
 }
@@ -69,16 +91,75 @@ func (r *Resolver) VisitCall(e *expr.Call) interface{} {
 }
 
 func (r *Resolver) VisitGet(get *expr.Get) interface{} {
-	r.resolveExpression(get)
+	r.checkPrivateAccess(get.Object, get.Name)
+	r.resolveExpression(get.Object)
 	return nil
 }
 
+// `#name` members can only be used as `this.#name`, inside the methods of the class declaring them
+func (r *Resolver) checkPrivateAccess(object expr.ExprInterface, name token.Token) {
+	if !strings.HasPrefix(name.Lexeme, "#") {
+		return
+	}
+	if _, ok := object.(*expr.This); !ok || r.CurrentClass != CLASS {
+		panic(fmt.Sprintf("%v: private member '%v' can only be accessed through 'this' inside its class", name, name.Lexeme))
+	}
+}
+
 func (r *Resolver) VisitGrouping(e *expr.Grouping) interface{} {
 	r.resolveExpression(e.Expression)
 	return nil
 }
 
+func (r *Resolver) VisitIndex(e *expr.Index) interface{} {
+	r.resolveExpression(e.Object)
+	r.resolveExpression(e.Index)
+	return nil
+}
+
+func (r *Resolver) VisitList(e *expr.List) interface{} {
+	for _, element := range e.Elements {
+		r.resolveExpression(element)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitMap(e *expr.Map) interface{} {
+	for ind, key := range e.Keys {
+		r.resolveExpression(key)
+		if e.Values[ind] != nil {
+			r.resolveExpression(e.Values[ind])
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) VisitIs(e *expr.Is) interface{} {
+	r.resolveExpression(e.Object)
+	r.resolveExpression(e.Target)
+	return nil
+}
+
+func (r *Resolver) VisitRange(e *expr.Range) interface{} {
+	r.resolveExpression(e.Start)
+	r.resolveExpression(e.End)
+	return nil
+}
+
+func (r *Resolver) VisitSpread(e *expr.Spread) interface{} {
+	r.resolveExpression(e.Expression)
+	return nil
+}
+
+// `break` and `continue` are parsed as literals of their token type
 func (r *Resolver) VisitLiteral(e *expr.Literal) interface{} {
+	if (e.Value == token.BREAK || e.Value == token.CONTINUE) && r.loops == 0 {
+		keyword := "break"
+		if e.Value == token.CONTINUE {
+			keyword = "continue"
+		}
+		panic(fmt.Sprintf("'%v' can only be used inside a loop", keyword))
+	}
 	return nil
 }
 
@@ -89,11 +170,17 @@ func (r *Resolver) VisitLogical(e *expr.Logical) interface{} {
 }
 
 func (r *Resolver) VisitSet(exp *expr.Set) interface{} {
+	r.checkPrivateAccess(exp.Object, exp.Name)
 	r.resolveExpression(exp.Value)
 	r.resolveExpression(exp.Object)
 	return nil
 }
 
+func (r *Resolver) VisitThis(e *expr.This) interface{} {
+	r.resolveLocal(e, e.Keyword)
+	return nil
+}
+
 func (r *Resolver) VisitUnary(e *expr.Unary) interface{} {
 	r.resolveExpression(e.Right)
 	return nil
@@ -105,8 +192,8 @@ func (r *Resolver) VisitVariable(e *expr.Variable) interface{} {
 		if !ok {
 			panic("scope wasn't seen in 'VisitVariable'")
 		}
-		if !scope[e.Name.Lexeme] {
-			panic(fmt.Sprintln("Can't read local variable in its own initializer: %v", e.Name.Lexeme))
+		if binding, declared := scope[e.Name.Lexeme]; declared && !binding.Defined {
+			panic(fmt.Sprintf("Can't read local variable in its own initializer: %v", e.Name.Lexeme))
 		}
 	}
 	r.resolveLocal(e, e.Name)
@@ -119,6 +206,7 @@ func (r *Resolver) VisitExpression(e *expr.Expression) interface{} {
 	return nil
 }
 func (r *Resolver) VisitFunction(e *expr.Function) interface{} {
+	r.resolveDecorators([]expr.StmtInterface{e})
 	r.declare(e.Name)
 	r.define(e.Name)
 	r.resolveFunction(e, FUNCTION)
@@ -138,17 +226,84 @@ func (r *Resolver) VisitPrint(e *expr.Print) interface{} {
 }
 func (r *Resolver) VisitWhile(e *expr.While) interface{} {
 	r.resolveExpression(e.Condition)
-	r.resolveStatement(e.Body)
+	r.resolveLoopBody(e.Body)
+	if e.Increment != nil {
+		r.resolveExpression(e.Increment)
+	}
+	return nil
+}
+func (r *Resolver) VisitDoWhile(e *expr.DoWhile) interface{} {
+	r.resolveLoopBody(e.Body)
+	r.resolveExpression(e.Condition)
+	return nil
+}
+func (r *Resolver) VisitForIn(e *expr.ForIn) interface{} {
+	r.resolveExpression(e.Iterable)
+	r.beginScope()
+	r.declare(e.Name)
+	r.define(e.Name)
+	r.resolveLoopBody(e.Body)
+	r.endScope()
 	return nil
 }
+
+func (r *Resolver) resolveLoopBody(body expr.StmtInterface) {
+	r.loops += 1
+	r.resolveStatement(body)
+	r.loops -= 1
+}
 func (r *Resolver) VisitVar(e *expr.Var) interface{} {
 	r.declare(e.Name)
 	if e.Initializer != nil {
 		r.resolveExpression(e.Initializer)
 	}
 	r.define(e.Name)
+	if e.Constant && r.Scopes.Len() != 0 {
+		r.Scopes.Peek().(Scope)[e.Name.Lexeme] = Binding{Defined: true, Const: true}
+	}
 	return nil
 }
+func (r *Resolver) VisitYield(e *expr.Yield) interface{} {
+	if r.CurrentFunction != GENERATOR {
+		panic(fmt.Sprintf("'%v' can only yield inside a generator", e.Keyword))
+	}
+	if e.Value != nil {
+		r.resolveExpression(e.Value)
+	}
+	return nil
+}
+
+// comptime expressions are resolved on their own by comptime.Evaluate, and replaced before this runs
+func (r *Resolver) VisitComptime(e *expr.Comptime) interface{} {
+	return nil
+}
+
+// a quoted template isn't resolved until it's expanded into the program
+func (r *Resolver) VisitQuote(e *expr.Quote) interface{} {
+	return nil
+}
+
+// a macro runs while parsing, and is resolved on its own by macro.Expander
+func (r *Resolver) VisitMacro(e *expr.Macro) interface{} {
+	return nil
+}
+
+func (r *Resolver) VisitAssert(e *expr.Assert) interface{} {
+	r.resolveExpression(e.Condition)
+	if e.Message != nil {
+		r.resolveExpression(e.Message)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitDefer(e *expr.Defer) interface{} {
+	if r.CurrentFunction == NONE {
+		panic(fmt.Sprintf("%v: 'defer' can only be used inside a function", e.Keyword))
+	}
+	r.resolveExpression(e.Call)
+	return nil
+}
+
 func (r *Resolver) VisitReturn(e *expr.Return) interface{} {
 	if r.CurrentFunction == NONE {
 		panic(fmt.Sprintf("'%v' cannot return from top level code", e.Keyword))
@@ -170,26 +325,144 @@ func (r *Resolver) VisitClass(class *expr.Class) interface{} {
 	r.declare(class.Name)
 	r.define(class.Name)
 
+	r.checkTraitConflicts(class)
+	for _, trait := range class.Traits {
+		r.resolveExpression(trait)
+	}
+	r.resolveDecorators(class.Methods)
+
+	enclosingClass := r.CurrentClass
+	r.CurrentClass = CLASS
+	r.beginScope()
+	r.Scopes.Peek().(Scope)["this"] = Binding{Defined: true}
+	// field initializers run like methods, with `this` bound to the new instance
+	for _, field := range class.Fields {
+		if initializer := field.(*expr.Var).Initializer; initializer != nil {
+			r.resolveExpression(initializer)
+		}
+	}
 	for _, method := range class.Methods {
 		fxn := method.(*expr.Function)
 		r.resolveFunction(fxn, METHOD)
 	}
+	r.endScope()
+	r.CurrentClass = enclosingClass
 	return nil
 }
 
-func (r *Resolver) ResolveStatements(stmts []expr.StmtInterface) bool {
-	successfullyResolved := true
-	defer func() {
-		if err := recover(); err != nil {
-			successfullyResolved = false
+func (r *Resolver) VisitRecord(record *expr.Record) interface{} {
+	r.declare(record.Name)
+	r.define(record.Name)
+
+	seen := make(map[string]bool)
+	for _, field := range record.Fields {
+		if strings.HasPrefix(field.Lexeme, "#") {
+			panic(fmt.Sprintf("%v: record fields can't be private", field))
 		}
-	}()
+		if seen[field.Lexeme] {
+			panic(fmt.Sprintf("%v: duplicate field '%v' in record %v", field, field.Lexeme, record.Name.Lexeme))
+		}
+		seen[field.Lexeme] = true
+	}
+	r.resolveDecorators(record.Methods)
+
+	enclosingClass := r.CurrentClass
+	r.CurrentClass = CLASS
+	r.beginScope()
+	r.Scopes.Peek().(Scope)["this"] = Binding{Defined: true}
+	for _, method := range record.Methods {
+		fxn := method.(*expr.Function)
+		if fxn.Name.Lexeme == "init" {
+			panic(fmt.Sprintf("%v: records can't declare 'init', their fields are set by the constructor", fxn.Name))
+		}
+		r.resolveFunction(fxn, METHOD)
+	}
+	r.endScope()
+	r.CurrentClass = enclosingClass
+	return nil
+}
+
+// decorators are evaluated where the function or class is declared, outside the method's scope
+func (r *Resolver) resolveDecorators(fxns []expr.StmtInterface) {
+	for _, fxn := range fxns {
+		for _, decorator := range fxn.(*expr.Function).Decorators {
+			r.resolveExpression(decorator)
+		}
+	}
+}
+
+// two traits providing the same method is an error, unless the class defines that method itself
+func (r *Resolver) checkTraitConflicts(class *expr.Class) {
+	own := make(map[string]bool)
+	for _, method := range class.Methods {
+		own[method.(*expr.Function).Name.Lexeme] = true
+	}
+	providedBy := make(map[string]string)
+	for _, t := range class.Traits {
+		trait := t.(*expr.Variable).Name.Lexeme
+		for _, method := range r.Traits[trait] {
+			if other, ok := providedBy[method]; ok && other != trait && !own[method] {
+				panic(fmt.Sprintf("%v: method '%v' is provided by both '%v' and '%v'; '%v' must override it", class.Name, method, other, trait, class.Name.Lexeme))
+			}
+			providedBy[method] = trait
+		}
+	}
+}
+
+func (r *Resolver) VisitTrait(trait *expr.Trait) interface{} {
+	r.declare(trait.Name)
+	r.define(trait.Name)
+
+	if r.Traits == nil {
+		r.Traits = make(map[string][]string)
+	}
+	r.resolveDecorators(trait.Methods)
+	names := make([]string, 0, len(trait.Methods))
+	// a trait doesn't own the private members of the classes using it
+	enclosingClass := r.CurrentClass
+	r.CurrentClass = TRAIT
+	r.beginScope()
+	r.Scopes.Peek().(Scope)["this"] = Binding{Defined: true}
+	for _, method := range trait.Methods {
+		fxn := method.(*expr.Function)
+		names = append(names, fxn.Name.Lexeme)
+		r.resolveFunction(fxn, METHOD)
+	}
+	r.endScope()
+	r.CurrentClass = enclosingClass
+	r.Traits[trait.Name.Lexeme] = names
+	return nil
+}
+
+func (r *Resolver) VisitEnum(enum *expr.Enum) interface{} {
+	r.declare(enum.Name)
+	r.define(enum.Name)
+	return nil
+}
 
+// ResolveStatements reports whether resolving finished without errors. an error is recorded
+// in r.Errors and resolving carries on with the next statement, so one pass finds them all
+func (r *Resolver) ResolveStatements(stmts []expr.StmtInterface) bool {
 	for _, s := range stmts {
-		r.resolveStatement(s)
+		r.resolveRecovering(s)
 	}
+	return len(r.Errors) == 0
+}
 
-	return successfullyResolved
+// resolveRecovering records the error in resolving stmt. the error can leave the resolver inside
+// one of stmt's scopes, classes or functions, so those are restored to how they were before stmt
+func (r *Resolver) resolveRecovering(stmt expr.StmtInterface) {
+	scopes, class, function, loops := r.Scopes.Len(), r.CurrentClass, r.CurrentFunction, r.loops
+	defer func() {
+		if err := recover(); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprint(err))
+			for r.Scopes.Len() > scopes {
+				r.endScope()
+			}
+			r.CurrentClass, r.CurrentFunction, r.loops = class, function, loops
+		}
+	}()
+	r.resolveStatement(stmt)
 }
 
 func (r *Resolver) resolveStatement(stmt expr.StmtInterface) {
@@ -203,14 +476,33 @@ func (r *Resolver) resolveExpression(exp expr.ExprInterface) {
 func (r *Resolver) resolveFunction(f *expr.Function, typ FunctionType) {
 	enclosingType := r.CurrentFunction
 	r.CurrentFunction = typ
+	// a function's body can't break or continue the loop it's declared in
+	enclosingLoops := r.loops
+	r.loops = 0
+	if f.Generator {
+		r.CurrentFunction = GENERATOR
+	}
 	r.beginScope()
 	for _, param := range f.Params {
 		r.declare(param)
 		r.define(param)
 	}
+	for _, clause := range f.Requires {
+		r.resolveExpression(clause.Condition)
+	}
 	r.ResolveStatements(f.Body)
+	// `ensures` clauses can also see the return value, as `result`
+	if len(f.Ensures) > 0 {
+		r.beginScope()
+		r.Scopes.Peek().(Scope)["result"] = Binding{Defined: true}
+		for _, clause := range f.Ensures {
+			r.resolveExpression(clause.Condition)
+		}
+		r.endScope()
+	}
 	r.endScope()
 	r.CurrentFunction = enclosingType
+	r.loops = enclosingLoops
 }
 
 func (r *Resolver) beginScope() {
@@ -222,6 +514,9 @@ func (r *Resolver) endScope() {
 }
 
 func (r *Resolver) declare(name token.Token) {
+	if strings.HasPrefix(name.Lexeme, "#") {
+		panic(fmt.Sprintf("%v: '#' names can only be used for class members", name))
+	}
 	if r.Scopes.Len() == 0 {
 		return
 	}
@@ -230,10 +525,12 @@ func (r *Resolver) declare(name token.Token) {
 	if !ok {
 		panic("scope wasn't valid")
 	}
-	if _, present := scope[name.Lexeme]; present {
+	if binding, present := scope[name.Lexeme]; present && binding.Const {
+		panic(fmt.Sprintf("%v: cannot redeclare constant '%v'", name, name.Lexeme))
+	} else if present {
 		panic(fmt.Sprintf("variable '%v' already exists in scope", name.Lexeme))
 	}
-	scope[name.Lexeme] = false
+	scope[name.Lexeme] = Binding{}
 }
 
 func (r *Resolver) define(name token.Token) {
@@ -244,13 +541,24 @@ func (r *Resolver) define(name token.Token) {
 	if !ok {
 		panic("scope not right type in 'define'")
 	}
-	scope[name.Lexeme] = true
+	scope[name.Lexeme] = Binding{Defined: true}
+}
+
+// lookup finds the innermost local binding for a name. globals aren't tracked by the resolver
+func (r *Resolver) lookup(tok token.Token) (Binding, bool) {
+	for i := r.Scopes.Len() - 1; i >= 0; i = i - 1 {
+		scope, ok := r.Scopes.Get(i).(Scope)
+		if binding, found := scope[tok.Lexeme]; ok && found {
+			return binding, true
+		}
+	}
+	return Binding{}, false
 }
 
 func (r *Resolver) resolveLocal(e expr.ExprInterface, tok token.Token) {
 	for i := r.Scopes.Len() - 1; i >= 0; i = i - 1 {
 		scope, ok := r.Scopes.Get(i).(Scope)
-		if ok && scope[tok.Lexeme] {
+		if ok && scope[tok.Lexeme].Defined {
 			r.Interpreter.Resolve(e, r.Scopes.Len()-1-i)
 			return
 		}
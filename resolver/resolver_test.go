@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/weiser/lox/interpreter"
+	"github.com/weiser/lox/parser"
+	"github.com/weiser/lox/scanner"
+)
+
+func resolve(t *testing.T, src string) *Resolver {
+	scanner := scanner.MakeScanner(src)
+	p := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := p.Parse()
+	if err != nil || p.ParsingErr != nil {
+		t.Fatalf("didn't parse, %v %v", err, p.ParsingErr)
+	}
+	r := &Resolver{Interpreter: interpreter.MakeInterpreter(), CurrentFunction: NONE}
+	r.ResolveStatements(stmts)
+	return r
+}
+
+func TestAssignToLocalConst(t *testing.T) {
+	r := resolve(t, `
+	fun f() {
+		const x = 1;
+		x = 2;
+	}
+	`)
+	if len(r.Errors) != 1 {
+		t.Errorf("expected 1 error for assigning to a const, got %v", r.Errors)
+	}
+}
+
+func TestShadowingLocalConst(t *testing.T) {
+	r := resolve(t, `
+	{
+		const x = 1;
+		{
+			var x = 2;
+			x = 3;
+		}
+	}
+	`)
+	if len(r.Errors) != 0 {
+		t.Errorf("expected no errors when a var shadows a const, got %v", r.Errors)
+	}
+}
+
+func TestRedeclareLocalConst(t *testing.T) {
+	r := resolve(t, `
+	{
+		const x = 1;
+		var x = 2;
+	}
+	`)
+	if len(r.Errors) != 1 {
+		t.Errorf("expected 1 error for redeclaring a const, got %v", r.Errors)
+	}
+}
+
+func TestBreakAndContinueOutsideLoop(t *testing.T) {
+	tests := []string{
+		`continue;`,
+		`fun f() { continue; }`,
+		`while (true) { fun g() { break; } }`,
+	}
+	for _, src := range tests {
+		if r := resolve(t, src); len(r.Errors) != 1 {
+			t.Errorf("expected 1 error for `%v`, got %v", src, r.Errors)
+		}
+	}
+	r := resolve(t, `while (true) { for (x in [1]) { if (x) continue; } do { break; } while (true); break; }`)
+	if len(r.Errors) != 0 {
+		t.Errorf("expected no errors for break and continue inside loops, got %v", r.Errors)
+	}
+}
+
+func TestErrorsAfterAnError(t *testing.T) {
+	r := resolve(t, `
+	fun f() {
+		{ continue; }
+		continue;
+	}
+	class A { m() { { var a; var a; } return this; } }
+	{ var b; var b; }
+	`)
+	if len(r.Errors) != 4 {
+		t.Errorf("expected 4 errors, got %v", r.Errors)
+	}
+	if r.Scopes.Len() != 0 || r.CurrentClass != NOCLASS || r.CurrentFunction != NONE {
+		t.Errorf("expected the resolver to be back at the top level")
+	}
+}
+
+func TestConflictingTraitMethods(t *testing.T) {
+	r := resolve(t, `
+	trait A { m() { return 1; } }
+	trait B { m() { return 2; } }
+	class C with A, B {}
+	class D with A, B { m() { return 3; } }
+	`)
+	if len(r.Errors) != 1 {
+		t.Errorf("expected 1 error for C's conflicting traits, got %v", r.Errors)
+	}
+}
+
+func TestPrivateMembers(t *testing.T) {
+	r := resolve(t, `
+	class Account {
+		init(b) { this.#balance = b; }
+		#check(n) { return n <= this.#balance; }
+		withdraw(n) { if (this.#check(n)) this.#balance = this.#balance - n; }
+	}
+	`)
+	if len(r.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", r.Errors)
+	}
+
+	for _, src := range []string{
+		`class A {} var a = A(); print a.#balance;`,
+		`class A {} var a = A(); a.#balance = 1;`,
+		`trait T { m() { return this.#balance; } }`,
+		`var #balance = 1;`,
+	} {
+		r := resolve(t, src)
+		if len(r.Errors) != 1 {
+			t.Errorf("expected 1 error for %v, got %v", src, r.Errors)
+		}
+	}
+}
+
+func TestRecordDeclarations(t *testing.T) {
+	for _, src := range []string{
+		`record Point(x, x)`,
+		`record Point(x, y) { init() {} }`,
+	} {
+		r := resolve(t, src)
+		if len(r.Errors) != 1 {
+			t.Errorf("expected 1 error for %v, got %v", src, r.Errors)
+		}
+	}
+}
+
+func TestDeferOutsideFunction(t *testing.T) {
+	r := resolve(t, `defer print1();`)
+	if len(r.Errors) != 1 {
+		t.Errorf("expected 1 error for a top level defer, got %v", r.Errors)
+	}
+}
+
+func TestContractClauses(t *testing.T) {
+	r := resolve(t, `fun f(x) requires x > 0 ensures result != x { var y = x; return y; }`)
+	if len(r.Errors) != 0 {
+		t.Errorf("expected contracts to resolve, got %v", r.Errors)
+	}
+}
@@ -52,10 +52,28 @@ func (s *Scanner) scanToken() {
 		s.addToken(token.LEFT_BRACE)
 	case '}':
 		s.addToken(token.RIGHT_BRACE)
+	case '[':
+		s.addToken(token.LEFT_BRACKET)
+	case ']':
+		s.addToken(token.RIGHT_BRACKET)
+	case ':':
+		s.addToken(token.COLON)
+	case '@':
+		s.addToken(token.AT)
 	case ',':
 		s.addToken(token.COMMA)
 	case '.':
-		s.addToken(token.DOT)
+		if s.match('.') {
+			if s.match('.') {
+				s.addToken(token.DOT_DOT_DOT)
+			} else if s.match('<') {
+				s.addToken(token.DOT_DOT_LESS)
+			} else {
+				s.addToken(token.DOT_DOT)
+			}
+		} else {
+			s.addToken(token.DOT)
+		}
 	case '-':
 		s.addToken(token.MINUS)
 	case '+':
@@ -118,6 +136,20 @@ func (s *Scanner) scanToken() {
 		} else {
 			s.addToken(token.SLASH)
 		}
+	case '#':
+		// `#name` is a private class member
+		if s.isAlpha(s.peek()) {
+			s.identifier()
+		} else {
+			s.Errors = append(s.Errors, Error{Source: s.Source[s.Start:s.Current], Line: s.Line, Start: s.Start, Current: s.Current, Message: "expect a member name after '#'"})
+		}
+	case '$':
+		// `$name` unquotes a value inside a macro's `quote`
+		if s.isAlpha(s.peek()) {
+			s.identifier()
+		} else {
+			s.Errors = append(s.Errors, Error{Source: s.Source[s.Start:s.Current], Line: s.Line, Start: s.Start, Current: s.Current, Message: "expect a name after '$'"})
+		}
 	case ' ', '\r', '\t':
 		// ignore non-\n whitespace
 	case '\n':
@@ -127,7 +159,7 @@ func (s *Scanner) scanToken() {
 	default:
 		if unicode.IsDigit(rune(s.Source[s.Current-1])) {
 			s.number()
-		} else if unicode.IsLetter(rune(s.Source[s.Current-1])) {
+		} else if s.isAlpha(rune(s.Source[s.Current-1])) {
 			s.identifier()
 		} else {
 			s.Errors = append(s.Errors, Error{Source: s.Source[s.Start:s.Current], Line: s.Line, Start: s.Start, Current: s.Current, Message: fmt.Sprintf("unknown token: %v", s.Source[s.Start:s.Current])})
@@ -137,23 +169,41 @@ func (s *Scanner) scanToken() {
 }
 
 var keywords = map[string]token.TType{
-	"and":    token.AND,
-	"class":  token.CLASS,
-	"else":   token.ELSE,
-	"false":  token.FALSE,
-	"for":    token.FOR,
-	"fun":    token.FUN,
-	"if":     token.IF,
-	"nil":    token.NIL,
-	"or":     token.OR,
-	"print":  token.PRINT,
-	"return": token.RETURN,
-	"super":  token.SUPER,
-	"this":   token.THIS,
-	"true":   token.TRUE,
-	"var":    token.VAR,
-	"while":  token.WHILE,
-	"break":  token.BREAK,
+	"and":      token.AND,
+	"class":    token.CLASS,
+	"const":    token.CONST,
+	"else":     token.ELSE,
+	"enum":     token.ENUM,
+	"false":    token.FALSE,
+	"for":      token.FOR,
+	"fun":      token.FUN,
+	"if":       token.IF,
+	"nil":      token.NIL,
+	"or":       token.OR,
+	"print":    token.PRINT,
+	"return":   token.RETURN,
+	"super":    token.SUPER,
+	"this":     token.THIS,
+	"true":     token.TRUE,
+	"var":      token.VAR,
+	"while":    token.WHILE,
+	"break":    token.BREAK,
+	"yield":    token.YIELD,
+	"in":       token.IN,
+	"trait":    token.TRAIT,
+	"with":     token.WITH,
+	"is":       token.IS,
+	"sealed":   token.SEALED,
+	"record":   token.RECORD,
+	"defer":    token.DEFER,
+	"continue": token.CONTINUE,
+	"do":       token.DO,
+	"assert":   token.ASSERT,
+	"macro":    token.MACRO,
+	"quote":    token.QUOTE,
+	"comptime": token.COMPTIME,
+	"requires": token.REQUIRES,
+	"ensures":  token.ENSURES,
 }
 
 func (s *Scanner) identifier() {
@@ -167,8 +217,13 @@ func (s *Scanner) identifier() {
 	s.addTokenWithObj(toktype, text)
 }
 
+// identifiers may contain underscores, e.g. the special methods `__add__` and `__str__`
+func (s *Scanner) isAlpha(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
 func (s *Scanner) isAlphanumeric(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r)
+	return s.isAlpha(r) || unicode.IsDigit(r)
 }
 func (s *Scanner) number() {
 	for ; unicode.IsDigit(s.peek()); s.advance() {
@@ -189,7 +244,7 @@ func (s *Scanner) peekNext() rune {
 	if s.Current+1 >= len(s.Source) {
 		return 0
 	}
-	return rune(s.Source[s.Current])
+	return rune(s.Source[s.Current+1])
 }
 
 func (s *Scanner) string() {
@@ -32,7 +32,7 @@ func TestScannerCreationOneCharacterLexemes(t *testing.T) {
 
 func TestScannerErrors(t *testing.T) {
 
-	for _, src := range "@" {
+	for _, src := range "~" {
 		scanner := MakeScanner(string(src))
 		scanner.ScanTokens()
 
@@ -43,11 +43,11 @@ func TestScannerErrors(t *testing.T) {
 }
 
 func TestScannerTokenAndError(t *testing.T) {
-	scanner := MakeScanner(")@")
+	scanner := MakeScanner(")~")
 	toks := scanner.ScanTokens()
 	errs := scanner.Errors
 	if len(errs) != 1 {
-		t.Errorf("should have one error. @ is not a valid lexeme")
+		t.Errorf("should have one error. ~ is not a valid lexeme")
 	}
 	if toks[0].TokenType != token.RIGHT_PAREN {
 		t.Errorf("token should be ')'. %v", toks)
@@ -62,6 +62,31 @@ func TestScannerTwoCharLexemes(t *testing.T) {
 	}
 }
 
+func TestScannerSpreadAndBrackets(t *testing.T) {
+	scanner := MakeScanner("[...a]")
+	toks := scanner.ScanTokens()
+	expected := []token.TType{token.LEFT_BRACKET, token.DOT_DOT_DOT, token.IDENTIFIER, token.RIGHT_BRACKET, token.EOF}
+	for ind, typ := range expected {
+		if toks[ind].TokenType != typ {
+			t.Errorf("token %v should be %v, got %v", ind, typ, toks[ind])
+		}
+	}
+}
+
+func TestScannerRange(t *testing.T) {
+	scanner := MakeScanner("1..2 1..<2.5")
+	toks := scanner.ScanTokens()
+	expected := []token.TType{token.NUMBER, token.DOT_DOT, token.NUMBER, token.NUMBER, token.DOT_DOT_LESS, token.NUMBER, token.EOF}
+	for ind, typ := range expected {
+		if toks[ind].TokenType != typ {
+			t.Errorf("token %v should be %v, got %v", ind, typ, toks[ind])
+		}
+	}
+	if toks[5].Literal != 2.5 {
+		t.Errorf("token literal should be 2.5, got %v", toks[5].Literal)
+	}
+}
+
 func TestScannerComment(t *testing.T) {
 	scanner := MakeScanner(`
 	// 123
@@ -163,3 +188,27 @@ func TestScannerIdentifiers(t *testing.T) {
 		t.Errorf("token should be id2, got %v", v)
 	}
 }
+
+func TestScannerUnderscoreIdentifiers(t *testing.T) {
+	scanner := MakeScanner(`__add__ snake_case`)
+	toks := scanner.ScanTokens()
+
+	if len(scanner.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", scanner.Errors)
+	}
+	if v, _ := toks[0].Literal.(string); toks[0].TokenType != token.IDENTIFIER || v != "__add__" {
+		t.Errorf("token should be identifier __add__, got %v", toks[0])
+	}
+	if v, _ := toks[1].Literal.(string); toks[1].TokenType != token.IDENTIFIER || v != "snake_case" {
+		t.Errorf("token should be identifier snake_case, got %v", toks[1])
+	}
+}
+
+func TestScannerPrivateName(t *testing.T) {
+	scanner := MakeScanner(`this.#balance`)
+	toks := scanner.ScanTokens()
+
+	if v, _ := toks[2].Literal.(string); toks[2].TokenType != token.IDENTIFIER || v != "#balance" {
+		t.Errorf("token should be identifier #balance, got %v", toks[2])
+	}
+}
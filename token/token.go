@@ -10,6 +10,10 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
+	COLON
+	AT
 	COMMA
 	DOT
 	MINUS
@@ -27,6 +31,9 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	DOT_DOT
+	DOT_DOT_LESS
+	DOT_DOT_DOT
 
 	//literals
 	IDENTIFIER
@@ -36,7 +43,9 @@ const (
 	//keywords
 	AND
 	CLASS
+	CONST
 	ELSE
+	ENUM
 	FALSE
 	TRUE
 	FUN
@@ -51,6 +60,22 @@ const (
 	VAR
 	WHILE
 	BREAK
+	YIELD
+	IN
+	TRAIT
+	WITH
+	IS
+	SEALED
+	RECORD
+	DEFER
+	CONTINUE
+	DO
+	ASSERT
+	MACRO
+	QUOTE
+	COMPTIME
+	REQUIRES
+	ENSURES
 
 	EOF
 )
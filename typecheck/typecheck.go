@@ -0,0 +1,691 @@
+package typecheck
+
+import (
+	"fmt"
+
+	"github.com/weiser/lox/expr"
+	"github.com/weiser/lox/token"
+)
+
+/*
+Checker is a static pass, run after the resolver and before the interpreter, that uses
+optional type annotations like
+
+```
+fun add(a: Number, b: Number): Number { return a + b; }
+var name: String = "lox";
+```
+
+plus the types it can infer locally to report mismatched types, wrong arities and calls
+on values that can't be called. Anything it can't be sure about is `Any`, and `Any` is
+compatible with everything, so unannotated code only fails on errors that would
+certainly happen at runtime.
+*/
+type Checker struct {
+	Errors []string
+
+	scopes []scope
+	// the first pass only collects `assigned` and `classes`; errors are reported by the second
+	collecting bool
+	// names that are assigned to anywhere. an unannotated variable that is reassigned could hold anything
+	assigned map[string]bool
+	classes  map[string]bool
+	// the declared return type of the function being checked, or "" when there isn't one
+	returnType Type
+}
+
+// Type is the static type of an expression. builtin kinds have fixed names, and every
+// class is a type named after the class
+type Type string
+
+const (
+	Any       Type = "Any"
+	Number    Type = "Number"
+	String    Type = "String"
+	Bool      Type = "Bool"
+	Nil       Type = "Nil"
+	List      Type = "List"
+	Map       Type = "Map"
+	Set       Type = "Set"
+	Range     Type = "Range"
+	Function  Type = "Function"
+	Generator Type = "Generator"
+	Class     Type = "Class"
+
+	// the immutable versions of List and Map
+	PersistentList Type = "PersistentList"
+	PersistentMap  Type = "PersistentMap"
+)
+
+var builtinTypes = map[Type]bool{
+	Any: true, Number: true, String: true, Bool: true, Nil: true, List: true,
+	Map: true, Set: true, Range: true, Function: true, Generator: true, Class: true,
+	PersistentList: true, PersistentMap: true,
+}
+
+// values of these types are never callable and never have operator methods
+var primitiveTypes = map[Type]bool{
+	Number: true, String: true, Bool: true, Nil: true, List: true, Map: true, Range: true,
+}
+
+type signature struct {
+	params   []Type
+	arity    int
+	variadic bool
+	returns  Type
+}
+
+type binding struct {
+	typ       Type
+	annotated bool
+	// set for names declared by `fun` or `class`
+	signature *signature
+	// set for names declared by `trait`, so classes using the trait can find its `init`
+	trait *expr.Trait
+}
+
+type scope map[string]binding
+
+func MakeChecker() *Checker {
+	return &Checker{assigned: make(map[string]bool), classes: make(map[string]bool)}
+}
+
+// Check reports whether the program is free of type errors. the errors are in c.Errors
+func (c *Checker) Check(stmts []expr.StmtInterface) bool {
+	c.collecting = true
+	c.run(stmts)
+	c.collecting = false
+	c.Errors = nil
+	c.run(stmts)
+	return len(c.Errors) == 0
+}
+
+func (c *Checker) run(stmts []expr.StmtInterface) {
+	c.scopes = []scope{{}}
+	c.returnType = ""
+	c.checkBlock(stmts)
+}
+
+// checkBlock declares the block's functions and classes before checking it, so calls
+// to functions declared further down (e.g. mutual recursion) are checked too. a name that an
+// enclosing scope already binds isn't declared early: until its declaration runs, the name
+// still means the outer binding, and the declaration's own Visit declares it at that point
+func (c *Checker) checkBlock(stmts []expr.StmtInterface) {
+	for _, stmt := range stmts {
+		var name string
+		var b binding
+		switch s := stmt.(type) {
+		case *expr.Function:
+			name, b = s.Name.Lexeme, c.functionBinding(s)
+		case *expr.Class:
+			name, b = s.Name.Lexeme, binding{typ: Class, signature: c.classSignature(s)}
+		case *expr.Record:
+			name, b = s.Name.Lexeme, binding{typ: Class, signature: recordSignature(s)}
+		case *expr.Trait:
+			name, b = s.Name.Lexeme, binding{typ: Any, trait: s}
+		default:
+			continue
+		}
+		if _, ok := c.lookup(name); !ok {
+			c.declare(name, b)
+		}
+	}
+	for _, stmt := range stmts {
+		stmt.Accept(c)
+	}
+}
+
+func (c *Checker) errorf(tok token.Token, format string, args ...interface{}) {
+	if !c.collecting {
+		c.Errors = append(c.Errors, fmt.Sprintf("%v: %v", tok, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (c *Checker) typeOf(e expr.ExprInterface) Type {
+	return e.Accept(c).(Type)
+}
+
+func (c *Checker) beginScope() {
+	c.scopes = append(c.scopes, scope{})
+}
+
+func (c *Checker) endScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *Checker) declare(name string, b binding) {
+	c.scopes[len(c.scopes)-1][name] = b
+}
+
+func (c *Checker) lookup(name string) (binding, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i -= 1 {
+		if b, ok := c.scopes[i][name]; ok {
+			return b, true
+		}
+	}
+	return binding{}, false
+}
+
+// annotation turns a type annotation into a Type. a missing or unknown annotation is Any
+func (c *Checker) annotation(tok token.Token) Type {
+	typ := Type(tok.Lexeme)
+	if !builtinTypes[typ] && !c.classes[tok.Lexeme] {
+		return Any
+	}
+	return typ
+}
+
+func (c *Checker) checkAnnotation(tok token.Token) {
+	if tok.Lexeme != "" && !builtinTypes[Type(tok.Lexeme)] && !c.classes[tok.Lexeme] {
+		c.errorf(tok, "unknown type '%v'", tok.Lexeme)
+	}
+}
+
+func compatible(declared Type, actual Type) bool {
+	return declared == Any || actual == Any || actual == Nil || declared == actual
+}
+
+func (c *Checker) functionSignature(f *expr.Function) *signature {
+	sig := &signature{params: make([]Type, 0), arity: len(f.Params), variadic: f.Variadic, returns: c.annotation(f.ReturnType)}
+	for ind := range f.Params {
+		if ind < len(f.ParamTypes) {
+			sig.params = append(sig.params, c.annotation(f.ParamTypes[ind]))
+		} else {
+			sig.params = append(sig.params, Any)
+		}
+	}
+	if f.Variadic {
+		sig.arity -= 1
+	}
+	if f.Generator {
+		sig.returns = Generator
+	}
+	return sig
+}
+
+// a class's signature is the signature of its `init` method, returning an instance. like the
+// interpreter, a class's own `init` overrides its traits', and later traits override earlier ones
+func (c *Checker) classSignature(class *expr.Class) *signature {
+	sig := &signature{params: make([]Type, 0), returns: Type(class.Name.Lexeme)}
+	for _, t := range class.Traits {
+		if v, ok := t.(*expr.Variable); ok {
+			if b, ok := c.lookup(v.Name.Lexeme); ok && b.trait != nil {
+				sig = c.initSignature(b.trait.Methods, sig)
+			}
+		}
+	}
+	sig = c.initSignature(class.Methods, sig)
+	sig.returns = Type(class.Name.Lexeme)
+	return sig
+}
+
+// initSignature is the signature of the `init` among methods, or sig if there isn't one
+func (c *Checker) initSignature(methods []expr.StmtInterface, sig *signature) *signature {
+	for _, method := range methods {
+		if m, ok := method.(*expr.Function); ok && m.Name.Lexeme == "init" {
+			sig = c.functionSignature(m)
+		}
+	}
+	return sig
+}
+
+// a record's constructor takes one argument of any type per field
+func recordSignature(record *expr.Record) *signature {
+	sig := &signature{params: make([]Type, 0, len(record.Fields)), arity: len(record.Fields), returns: Type(record.Name.Lexeme)}
+	for range record.Fields {
+		sig.params = append(sig.params, Any)
+	}
+	return sig
+}
+
+func (c *Checker) expectNumber(operator token.Token, typ Type) {
+	if primitiveTypes[typ] && typ != Number {
+		c.errorf(operator, "operand of '%v' must be a Number, got %v", operator.Lexeme, typ)
+	}
+}
+
+func (c *Checker) VisitExpr(e *expr.Expr) interface{} { return Any }
+
+func (c *Checker) VisitAssign(e *expr.Assign) interface{} {
+	typ := c.typeOf(e.Value)
+	if c.collecting {
+		c.assigned[e.Name.Lexeme] = true
+	}
+	if b, ok := c.lookup(e.Name.Lexeme); ok && b.annotated && !compatible(b.typ, typ) {
+		c.errorf(e.Name, "cannot assign %v to '%v' of type %v", typ, e.Name.Lexeme, b.typ)
+	}
+	return typ
+}
+
+func (c *Checker) VisitBinary(e *expr.Binary) interface{} {
+	left := c.typeOf(e.Left)
+	right := c.typeOf(e.Right)
+
+	// an instance's class can overload arithmetic and comparisons, so the result could be anything.
+	// the right operand's class can too, e.g. `2 * v` calls `v.__rmul__(2)`
+	overloaded := !primitiveTypes[left] || (!primitiveTypes[right] && right != Any)
+	if overloaded && e.Operator.TokenType != token.EQUAL_EQUAL && e.Operator.TokenType != token.BANG_EQUAL {
+		return Any
+	}
+
+	switch e.Operator.TokenType {
+	case token.MINUS, token.SLASH, token.STAR:
+		c.expectNumber(e.Operator, left)
+		c.expectNumber(e.Operator, right)
+		return Number
+	case token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+		c.expectNumber(e.Operator, left)
+		c.expectNumber(e.Operator, right)
+		return Bool
+	case token.PLUS:
+		if left == right && (left == Number || left == String) {
+			return left
+		}
+		if primitiveTypes[left] && primitiveTypes[right] {
+			c.errorf(e.Operator, "cannot add %v and %v", left, right)
+		}
+		return Any
+	case token.EQUAL_EQUAL, token.BANG_EQUAL:
+		return Bool
+	}
+	return Any
+}
+
+func (c *Checker) VisitCall(e *expr.Call) interface{} {
+	callee := c.typeOf(e.Callee)
+	args := make([]Type, 0, len(e.Arguments))
+	spread := false
+	for _, arg := range e.Arguments {
+		if _, ok := arg.(*expr.Spread); ok {
+			spread = true
+		}
+		args = append(args, c.typeOf(arg))
+	}
+
+	if primitiveTypes[callee] {
+		c.errorf(e.Paren, "can only call functions and classes, not %v", callee)
+		return Any
+	}
+
+	variable, ok := e.Callee.(*expr.Variable)
+	if !ok || c.assigned[variable.Name.Lexeme] {
+		return Any
+	}
+	b, ok := c.lookup(variable.Name.Lexeme)
+	if !ok || b.signature == nil {
+		return Any
+	}
+	sig := b.signature
+	if !spread {
+		if sig.variadic && len(args) < sig.arity {
+			c.errorf(e.Paren, "'%v' expects at least %v arguments, got %v", variable.Name.Lexeme, sig.arity, len(args))
+		} else if !sig.variadic && len(args) != sig.arity {
+			c.errorf(e.Paren, "'%v' expects %v arguments, got %v", variable.Name.Lexeme, sig.arity, len(args))
+		}
+	}
+	for ind, arg := range e.Arguments {
+		if _, ok := arg.(*expr.Spread); ok || ind >= sig.arity {
+			// after a spread we no longer know which parameter an argument lines up with
+			break
+		}
+		if !compatible(sig.params[ind], args[ind]) {
+			c.errorf(e.Paren, "argument %v of '%v' must be %v, got %v", ind+1, variable.Name.Lexeme, sig.params[ind], args[ind])
+		}
+	}
+	return sig.returns
+}
+
+func (c *Checker) VisitGet(e *expr.Get) interface{} {
+	c.typeOf(e.Object)
+	return Any
+}
+
+func (c *Checker) VisitGrouping(e *expr.Grouping) interface{} {
+	return c.typeOf(e.Expression)
+}
+
+func (c *Checker) VisitIndex(e *expr.Index) interface{} {
+	object := c.typeOf(e.Object)
+	c.typeOf(e.Index)
+	switch object {
+	case Number, Bool, Nil:
+		c.errorf(e.Bracket, "cannot index a %v", object)
+	case String:
+		return String
+	}
+	return Any
+}
+
+func (c *Checker) VisitList(e *expr.List) interface{} {
+	for _, element := range e.Elements {
+		c.typeOf(element)
+	}
+	return List
+}
+
+func (c *Checker) VisitLiteral(e *expr.Literal) interface{} {
+	switch e.Value.(type) {
+	case nil:
+		return Nil
+	case float64, int:
+		return Number
+	case string:
+		return String
+	case bool:
+		return Bool
+	}
+	return Any
+}
+
+func (c *Checker) VisitLogical(e *expr.Logical) interface{} {
+	left := c.typeOf(e.Left)
+	right := c.typeOf(e.Right)
+	if left == right {
+		return left
+	}
+	return Any
+}
+
+func (c *Checker) VisitMap(e *expr.Map) interface{} {
+	for ind, key := range e.Keys {
+		c.typeOf(key)
+		if e.Values[ind] != nil {
+			c.typeOf(e.Values[ind])
+		}
+	}
+	return Map
+}
+
+func (c *Checker) VisitIs(e *expr.Is) interface{} {
+	c.typeOf(e.Object)
+	return Bool
+}
+
+func (c *Checker) VisitRange(e *expr.Range) interface{} {
+	c.expectNumber(e.Operator, c.typeOf(e.Start))
+	c.expectNumber(e.Operator, c.typeOf(e.End))
+	return Range
+}
+
+func (c *Checker) VisitSet(e *expr.Set) interface{} {
+	c.typeOf(e.Object)
+	return c.typeOf(e.Value)
+}
+
+func (c *Checker) VisitSpread(e *expr.Spread) interface{} {
+	c.typeOf(e.Expression)
+	return Any
+}
+
+func (c *Checker) VisitComptime(e *expr.Comptime) interface{} {
+	return Any
+}
+
+// quoted code is checked where it's expanded
+func (c *Checker) VisitQuote(e *expr.Quote) interface{} {
+	return Any
+}
+
+func (c *Checker) VisitThis(e *expr.This) interface{} {
+	if b, ok := c.lookup("this"); ok {
+		return b.typ
+	}
+	return Any
+}
+
+func (c *Checker) VisitUnary(e *expr.Unary) interface{} {
+	right := c.typeOf(e.Right)
+	if e.Operator.TokenType == token.BANG {
+		return Bool
+	}
+	c.expectNumber(e.Operator, right)
+	return Number
+}
+
+func (c *Checker) VisitVariable(e *expr.Variable) interface{} {
+	if b, ok := c.lookup(e.Name.Lexeme); ok {
+		return b.typ
+	}
+	return Any
+}
+
+func (c *Checker) VisitStmt(e *expr.Stmt) interface{} { return nil }
+
+func (c *Checker) VisitBlock(e *expr.Block) interface{} {
+	c.beginScope()
+	c.checkBlock(e.Statements)
+	c.endScope()
+	return nil
+}
+
+func (c *Checker) VisitClass(e *expr.Class) interface{} {
+	if c.collecting {
+		c.classes[e.Name.Lexeme] = true
+	}
+	c.declare(e.Name.Lexeme, binding{typ: Class, signature: c.classSignature(e)})
+	for _, trait := range e.Traits {
+		c.typeOf(trait)
+	}
+
+	c.beginScope()
+	c.declare("this", binding{typ: Type(e.Name.Lexeme)})
+	// fields are checked like variables, in a scope of their own so methods can't see them as variables
+	c.beginScope()
+	for _, field := range e.Fields {
+		c.VisitVar(field.(*expr.Var))
+	}
+	c.endScope()
+	for _, method := range e.Methods {
+		if m, ok := method.(*expr.Function); ok {
+			c.checkFunction(m)
+		}
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *Checker) VisitRecord(e *expr.Record) interface{} {
+	if c.collecting {
+		c.classes[e.Name.Lexeme] = true
+	}
+	c.declare(e.Name.Lexeme, binding{typ: Class, signature: recordSignature(e)})
+
+	c.beginScope()
+	c.declare("this", binding{typ: Type(e.Name.Lexeme)})
+	for _, method := range e.Methods {
+		if m, ok := method.(*expr.Function); ok {
+			c.checkFunction(m)
+		}
+	}
+	c.endScope()
+	return nil
+}
+
+// trait methods are checked like methods, but `this` can be any class using the trait
+func (c *Checker) VisitTrait(e *expr.Trait) interface{} {
+	c.declare(e.Name.Lexeme, binding{typ: Any, trait: e})
+
+	c.beginScope()
+	c.declare("this", binding{typ: Any})
+	for _, method := range e.Methods {
+		if m, ok := method.(*expr.Function); ok {
+			c.checkFunction(m)
+		}
+	}
+	c.endScope()
+	return nil
+}
+
+// an enum's name can be used as the type of its values
+func (c *Checker) VisitEnum(e *expr.Enum) interface{} {
+	if c.collecting {
+		c.classes[e.Name.Lexeme] = true
+	}
+	c.declare(e.Name.Lexeme, binding{typ: Any})
+	return nil
+}
+
+func (c *Checker) VisitExpression(e *expr.Expression) interface{} {
+	c.typeOf(e.Expression)
+	return nil
+}
+
+func (c *Checker) VisitFunction(e *expr.Function) interface{} {
+	c.declare(e.Name.Lexeme, c.functionBinding(e))
+	c.checkFunction(e)
+	return nil
+}
+
+// a decorator can replace a function with anything, so we only know a decorated function's name
+func (c *Checker) functionBinding(f *expr.Function) binding {
+	if len(f.Decorators) > 0 {
+		return binding{typ: Any}
+	}
+	return binding{typ: Function, signature: c.functionSignature(f)}
+}
+
+func (c *Checker) checkFunction(f *expr.Function) {
+	for _, decorator := range f.Decorators {
+		c.typeOf(decorator)
+	}
+	for _, typ := range f.ParamTypes {
+		c.checkAnnotation(typ)
+	}
+	c.checkAnnotation(f.ReturnType)
+	sig := c.functionSignature(f)
+	enclosingReturn := c.returnType
+	c.returnType = sig.returns
+	if f.Generator || sig.returns == Any {
+		c.returnType = ""
+	}
+
+	c.beginScope()
+	for ind, param := range f.Params {
+		if f.Variadic && ind == len(f.Params)-1 {
+			c.declare(param.Lexeme, binding{typ: List, annotated: true})
+		} else {
+			c.declare(param.Lexeme, binding{typ: sig.params[ind], annotated: sig.params[ind] != Any})
+		}
+	}
+	for _, clause := range f.Requires {
+		c.typeOf(clause.Condition)
+	}
+	c.checkBlock(f.Body)
+	if len(f.Ensures) > 0 {
+		c.beginScope()
+		c.declare("result", binding{typ: sig.returns})
+		for _, clause := range f.Ensures {
+			c.typeOf(clause.Condition)
+		}
+		c.endScope()
+	}
+	c.endScope()
+
+	c.returnType = enclosingReturn
+}
+
+func (c *Checker) VisitIf(e *expr.If) interface{} {
+	c.typeOf(e.Condition)
+	e.ThenBranch.Accept(c)
+	if e.ElseBranch != nil {
+		e.ElseBranch.Accept(c)
+	}
+	return nil
+}
+
+func (c *Checker) VisitPrint(e *expr.Print) interface{} {
+	c.typeOf(e.Expression)
+	return nil
+}
+
+func (c *Checker) VisitWhile(e *expr.While) interface{} {
+	c.typeOf(e.Condition)
+	e.Body.Accept(c)
+	if e.Increment != nil {
+		c.typeOf(e.Increment)
+	}
+	return nil
+}
+
+func (c *Checker) VisitDoWhile(e *expr.DoWhile) interface{} {
+	e.Body.Accept(c)
+	c.typeOf(e.Condition)
+	return nil
+}
+
+func (c *Checker) VisitForIn(e *expr.ForIn) interface{} {
+	iterable := c.typeOf(e.Iterable)
+	element := Any
+	switch iterable {
+	case Number, Bool, Nil:
+		c.errorf(e.Name, "cannot iterate over a %v", iterable)
+	case String:
+		element = String
+	case Range:
+		element = Number
+	}
+
+	c.beginScope()
+	c.declare(e.Name.Lexeme, binding{typ: element})
+	e.Body.Accept(c)
+	c.endScope()
+	return nil
+}
+
+func (c *Checker) VisitVar(e *expr.Var) interface{} {
+	c.checkAnnotation(e.Type)
+	declared := c.annotation(e.Type)
+	actual := Nil
+	if e.Initializer != nil {
+		actual = c.typeOf(e.Initializer)
+	}
+
+	if e.Type.Lexeme != "" {
+		if !compatible(declared, actual) {
+			c.errorf(e.Name, "cannot initialize '%v' of type %v with %v", e.Name.Lexeme, declared, actual)
+		}
+		c.declare(e.Name.Lexeme, binding{typ: declared, annotated: true})
+		return nil
+	}
+
+	if c.assigned[e.Name.Lexeme] {
+		actual = Any
+	}
+	c.declare(e.Name.Lexeme, binding{typ: actual})
+	return nil
+}
+
+func (c *Checker) VisitMacro(e *expr.Macro) interface{} {
+	return nil
+}
+
+func (c *Checker) VisitAssert(e *expr.Assert) interface{} {
+	c.typeOf(e.Condition)
+	if e.Message != nil {
+		c.typeOf(e.Message)
+	}
+	return nil
+}
+
+func (c *Checker) VisitDefer(e *expr.Defer) interface{} {
+	c.typeOf(e.Call)
+	return nil
+}
+
+func (c *Checker) VisitReturn(e *expr.Return) interface{} {
+	actual := Nil
+	if e.Value != nil {
+		actual = c.typeOf(e.Value)
+	}
+	if c.returnType != "" && !compatible(c.returnType, actual) {
+		c.errorf(e.Keyword, "cannot return %v from a function returning %v", actual, c.returnType)
+	}
+	return nil
+}
+
+func (c *Checker) VisitYield(e *expr.Yield) interface{} {
+	if e.Value != nil {
+		c.typeOf(e.Value)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/weiser/lox/parser"
+	"github.com/weiser/lox/scanner"
+)
+
+func check(t *testing.T, src string) *Checker {
+	scanner := scanner.MakeScanner(src)
+	p := parser.Parser{Tokens: scanner.ScanTokens()}
+	stmts, err := p.Parse()
+	if err != nil || p.ParsingErr != nil {
+		t.Fatalf("didn't parse, %v %v", err, p.ParsingErr)
+	}
+	c := MakeChecker()
+	c.Check(stmts)
+	return c
+}
+
+func TestAnnotatedProgramChecks(t *testing.T) {
+	c := check(t, `
+	fun add(a: Number, b: Number): Number { return a + b; }
+	class Point { init(x: Number, y: Number) { this.x = x; this.y = y; } }
+	var total: Number = add(1, 2);
+	var p: Point = Point(1, total);
+	var greeting: String = "hi";
+	var later = nil;
+	while (later == nil) { later = 1; }
+	print later + 1;
+	`)
+	if len(c.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", c.Errors)
+	}
+}
+
+func TestTypeMismatches(t *testing.T) {
+	c := check(t, `
+	fun add(a: Number, b: Number): Number { return a + b; }
+	fun name(): String { return 1; }
+	var s: String = 1;
+	add("1", 2);
+	print "a" - 1;
+	`)
+	if len(c.Errors) != 4 {
+		t.Errorf("expected 4 errors, got %v", c.Errors)
+	}
+}
+
+func TestArityAndCallable(t *testing.T) {
+	c := check(t, `
+	fun add(a, b) { return a + b; }
+	class Point { init(x, y) {} }
+	add(1);
+	Point(1, 2, 3);
+	var n = 1;
+	n();
+	add(...[1, 2]);
+	`)
+	if len(c.Errors) != 3 {
+		t.Errorf("expected 3 errors, got %v", c.Errors)
+	}
+}
+
+func TestUnknownType(t *testing.T) {
+	c := check(t, `var n: Nubmer = 1;`)
+	if len(c.Errors) != 1 {
+		t.Errorf("expected 1 error, got %v", c.Errors)
+	}
+}
+
+func TestOverloadedOperators(t *testing.T) {
+	c := check(t, `
+	class Vec { __mul__(k) { return [k, k]; } __rmul__(k) { return [k, k]; } }
+	var v: Vec = Vec();
+	print (v * 2)[0];
+	print (2 * v)[0];
+	`)
+	if len(c.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", c.Errors)
+	}
+}
+
+func TestTraitInit(t *testing.T) {
+	c := check(t, `
+	trait T { init(x) {} }
+	trait U { init(x, y) {} }
+	class C with T {}
+	class D with T, U {}
+	class E with T { init() {} }
+	C(1);
+	D(1, 2);
+	E();
+	C();
+	`)
+	if len(c.Errors) != 1 {
+		t.Errorf("expected 1 error, got %v", c.Errors)
+	}
+}
+
+func TestShadowingFunctionInBlock(t *testing.T) {
+	c := check(t, `
+	fun f(a) { return a; }
+	{
+		print f(1);
+		fun f(a, b) { return b; }
+		print f(1, 2);
+	}
+	`)
+	if len(c.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", c.Errors)
+	}
+}